@@ -14,6 +14,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 type AwsClient struct {
@@ -22,6 +24,7 @@ type AwsClient struct {
 	authStr string
 	mutex   sync.Mutex
 	log     *slog.Logger
+	quit    chan struct{}
 }
 
 func CreateSecretsManagerClient(region string) *secretsmanager.Client {
@@ -35,6 +38,32 @@ func CreateSecretsManagerClient(region string) *secretsmanager.Client {
 	return secretsmanager.NewFromConfig(cfg)
 }
 
+func CreateSsmClient(region string) *ssm.Client {
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return ssm.NewFromConfig(cfg)
+}
+
+// CreateSqsClient creates an SQS client for region. A non-empty endpoint
+// replaces the AWS endpoint, for local SQS compatible servers.
+func CreateSqsClient(region, endpoint string) *sqs.Client {
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = &endpoint
+		}
+	})
+}
+
 func CreateEcrClient() *ecr.Client {
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
@@ -100,6 +129,11 @@ func (a *AwsClient) retrieveToken() (string, error) {
 	return *resp.AuthorizationData[0].AuthorizationToken, nil
 }
 
+// DescribeImages lists the images of an ECR repository.
+func (a *AwsClient) DescribeImages(ctx context.Context, params *ecr.DescribeImagesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error) {
+	return a.client.DescribeImages(ctx, params, optFns...)
+}
+
 func tokenFromAuthStr(authStr string) (string, string, error) {
 	decodedToken, err := base64.StdEncoding.DecodeString(authStr)
 	if err != nil {
@@ -126,6 +160,8 @@ func (a *AwsClient) startTokenRefresh() {
 
 	for {
 		select {
+		case <-a.quit:
+			return
 		case <-ticker.C:
 			err := a.UpdateToken()
 			if err != nil {
@@ -142,11 +178,19 @@ func NewAwsClient(client *ecr.Client) *AwsClient {
 	awsClient := &AwsClient{
 		client: client,
 		log:    log,
+		quit:   make(chan struct{}),
 	}
 	go awsClient.startTokenRefresh()
 	return awsClient
 }
 
+// Close stops the background token refresh.
 func (a *AwsClient) Close() {
-	// nothing to close atm
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	select {
+	case <-a.quit:
+	default:
+		close(a.quit)
+	}
 }
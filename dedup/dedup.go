@@ -0,0 +1,64 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Deduplicator remembers keys for a window of time so repeated deliveries of
+// the same event can be recognised.
+type Deduplicator struct {
+	window time.Duration
+	seen   map[string]entry
+	now    func() time.Time
+	mutex  sync.Mutex
+}
+
+type entry struct {
+	origin  string
+	expires time.Time
+}
+
+func New(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		seen:   make(map[string]entry),
+		now:    time.Now,
+	}
+}
+
+// Seen reports whether any of keys was recorded within the window and, if
+// so, the origin it was recorded with. Otherwise all keys are recorded with
+// origin, so the check and the record happen atomically. Empty keys are
+// ignored.
+func (d *Deduplicator) Seen(origin string, keys ...string) (string, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := d.now()
+	for key, e := range d.seen {
+		if now.After(e.expires) {
+			delete(d.seen, key)
+		}
+	}
+	for _, key := range keys {
+		if e, ok := d.seen[key]; ok && key != "" {
+			return e.origin, true
+		}
+	}
+	for _, key := range keys {
+		if key != "" {
+			d.seen[key] = entry{origin: origin, expires: now.Add(d.window)}
+		}
+	}
+	return "", false
+}
+
+// Forget removes keys, for example when the event they belong to could not
+// be processed and a retry should be accepted.
+func (d *Deduplicator) Forget(keys ...string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, key := range keys {
+		delete(d.seen, key)
+	}
+}
@@ -0,0 +1,39 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeen(t *testing.T) {
+	now := time.Now()
+	d := New(time.Minute)
+	d.now = func() time.Time { return now }
+
+	if _, ok := d.Seen("event-1", "id:event-1", "image:/repo|v1|sha256:a"); ok {
+		t.Fatalf("Expected first delivery not to be a duplicate")
+	}
+	if origin, ok := d.Seen("event-1", "id:event-1", "image:/repo|v1|sha256:a"); !ok || origin != "event-1" {
+		t.Fatalf("Expected redelivery to be a duplicate of event-1, got %q %v", origin, ok)
+	}
+	if origin, ok := d.Seen("event-2", "id:event-2", "image:/repo|v1|sha256:a"); !ok || origin != "event-1" {
+		t.Fatalf("Expected same image under a new event id to be a duplicate, got %q %v", origin, ok)
+	}
+	if _, ok := d.Seen("event-3", "id:event-3", ""); ok {
+		t.Fatalf("Expected empty keys to be ignored")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := d.Seen("event-1", "id:event-1", "image:/repo|v1|sha256:a"); ok {
+		t.Fatalf("Expected keys to expire after the window")
+	}
+}
+
+func TestForget(t *testing.T) {
+	d := New(time.Minute)
+	d.Seen("event-1", "id:event-1")
+	d.Forget("id:event-1")
+	if _, ok := d.Seen("event-1", "id:event-1"); ok {
+		t.Fatalf("Expected forgotten key to be accepted again")
+	}
+}
@@ -0,0 +1,211 @@
+package deployment
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	StatusDuplicate Status = "duplicate"
+)
+
+// Trigger is what caused a deployment.
+type Trigger string
+
+const (
+	TriggerWebhook  Trigger = "webhook"
+	TriggerRollback Trigger = "rollback"
+	TriggerManual   Trigger = "manual"
+)
+
+type Phase string
+
+const (
+	PhasePull   Phase = "pull"
+	PhaseStop   Phase = "stop"
+	PhaseCreate Phase = "create"
+	PhaseStart  Phase = "start"
+	PhaseRemove Phase = "remove"
+)
+
+// Deployment is a request to run Tag for the watched image Repository. Its
+// progress is updated by the worker running it and read through Snapshot.
+type Deployment struct {
+	ID         string
+	Repository string
+	Tag        string
+	// ImageTagPrefix selects the watched entry to deploy to. When empty, the
+	// first entry whose prefix matches Tag is used. It must be set before the
+	// deployment is queued.
+	ImageTagPrefix string
+	// Caller is the authenticated client that requested the deployment. It
+	// must be set before the deployment is queued.
+	Caller string
+	// EventID identifies the registry event that caused the deployment. It
+	// must be set before the deployment is queued.
+	EventID string
+	Trigger Trigger
+	record  Record
+	mutex   sync.Mutex
+}
+
+// PhaseRecord holds the timing of one step of a deployment.
+type PhaseRecord struct {
+	Phase      Phase      `json:"phase"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Record is a point in time copy of a deployment.
+type Record struct {
+	ID             string        `json:"id"`
+	Trigger        Trigger       `json:"trigger"`
+	Repository     string        `json:"repository"`
+	ImageTagPrefix string        `json:"imageTagPrefix,omitempty"`
+	Caller         string        `json:"caller,omitempty"`
+	EventID        string        `json:"eventId,omitempty"`
+	DuplicateOf    string        `json:"duplicateOf,omitempty"`
+	Tag            string        `json:"tag"`
+	PreviousTag    string        `json:"previousTag,omitempty"`
+	OldContainerID string        `json:"oldContainerId,omitempty"`
+	ContainerID    string        `json:"containerId,omitempty"`
+	Status         Status        `json:"status"`
+	Error          string        `json:"error,omitempty"`
+	QueuedAt       time.Time     `json:"queuedAt"`
+	StartedAt      *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time    `json:"finishedAt,omitempty"`
+	Phases         []PhaseRecord `json:"phases"`
+}
+
+func New(trigger Trigger, repository, tag string) *Deployment {
+	id := newID()
+	return &Deployment{
+		ID:         id,
+		Repository: repository,
+		Tag:        tag,
+		Trigger:    trigger,
+		record: Record{
+			ID:         id,
+			Trigger:    trigger,
+			Repository: repository,
+			Tag:        tag,
+			Status:     StatusQueued,
+			QueuedAt:   time.Now(),
+			Phases:     []PhaseRecord{},
+		},
+	}
+}
+
+// Snapshot returns a copy of the deployment that is safe to read while the
+// deployment is running.
+func (d *Deployment) Snapshot() Record {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	record := d.record
+	record.ImageTagPrefix = d.ImageTagPrefix
+	record.Caller = d.Caller
+	record.EventID = d.EventID
+	record.Phases = make([]PhaseRecord, len(d.record.Phases))
+	copy(record.Phases, d.record.Phases)
+	return record
+}
+
+// SetPrevious records what was running before this deployment.
+func (d *Deployment) SetPrevious(tag, containerID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.record.PreviousTag = tag
+	d.record.OldContainerID = containerID
+}
+
+// SetContainer records the container created by this deployment.
+func (d *Deployment) SetContainer(containerID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.record.ContainerID = containerID
+}
+
+// StartPhase marks the beginning of phase.
+func (d *Deployment) StartPhase(phase Phase) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.record.Phases = append(d.record.Phases, PhaseRecord{Phase: phase, StartedAt: time.Now()})
+}
+
+// EndPhase marks the most recent run of phase as finished, failed if err is
+// not nil.
+func (d *Deployment) EndPhase(phase Phase, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for n := len(d.record.Phases) - 1; n >= 0; n-- {
+		if d.record.Phases[n].Phase != phase {
+			continue
+		}
+		now := time.Now()
+		d.record.Phases[n].FinishedAt = &now
+		if err != nil {
+			d.record.Phases[n].Error = err.Error()
+		}
+		return
+	}
+}
+
+func (d *Deployment) start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	d.record.Status = StatusRunning
+	d.record.StartedAt = &now
+}
+
+// MarkDuplicate records that the deployment was not run because it repeats
+// the event origin.
+func (d *Deployment) MarkDuplicate(origin string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	d.record.FinishedAt = &now
+	d.record.Status = StatusDuplicate
+	d.record.DuplicateOf = origin
+}
+
+func (d *Deployment) cancel(reason error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	d.record.FinishedAt = &now
+	d.record.Status = StatusCancelled
+	d.record.Error = reason.Error()
+}
+
+func (d *Deployment) finish(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	d.record.FinishedAt = &now
+	if err != nil {
+		d.record.Status = StatusFailed
+		d.record.Error = err.Error()
+		return
+	}
+	d.record.Status = StatusSucceeded
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,197 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+var (
+	ErrQueueFull   = errors.New("deployment queue is full")
+	ErrQueueClosed = errors.New("deployment queue is closed")
+)
+
+// Handler performs a deployment and returns why it failed, if it did. ctx is
+// cancelled when the queue is shut down before the deployment finished.
+type Handler func(ctx context.Context, d *Deployment) error
+
+// Queue runs deployments on a pool of workers. Deployments for the same
+// repository run one at a time in the order they were queued, while
+// different repositories are deployed in parallel.
+type Queue struct {
+	handler    Handler
+	workers    int
+	maxPending int
+	pending    map[string][]*Deployment
+	active     map[string]bool
+	size       int
+	closed     bool
+	ready      chan string
+	// space is signalled when a deployment leaves pending or the queue closes
+	space  *sync.Cond
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mutex  sync.Mutex
+}
+
+func NewQueue(workers, maxPending int, handler Handler) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		ctx:        ctx,
+		cancel:     cancel,
+		handler:    handler,
+		workers:    workers,
+		maxPending: maxPending,
+		pending:    make(map[string][]*Deployment),
+		active:     make(map[string]bool),
+		// every active repository has at least one pending deployment, so
+		// sends on ready never block
+		ready: make(chan string, maxPending),
+	}
+	q.space = sync.NewCond(&q.mutex)
+	return q
+}
+
+func (q *Queue) Start() {
+	slog.Info("Starting deployment workers", "workers", q.workers)
+	for n := 0; n < q.workers; n++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Enqueue schedules d. It fails when maxPending deployments are already
+// waiting or the queue has been closed.
+func (q *Queue) Enqueue(d *Deployment) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.enqueue(d)
+}
+
+// EnqueueWait schedules d like Enqueue, but waits for room instead of failing
+// when maxPending deployments are waiting. The workers must be running.
+func (q *Queue) EnqueueWait(d *Deployment) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.closed && q.size >= q.maxPending {
+		q.space.Wait()
+	}
+	return q.enqueue(d)
+}
+
+func (q *Queue) enqueue(d *Deployment) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.size >= q.maxPending {
+		return ErrQueueFull
+	}
+	q.size++
+	q.pending[d.Repository] = append(q.pending[d.Repository], d)
+	if !q.active[d.Repository] {
+		q.active[d.Repository] = true
+		q.ready <- d.Repository
+	}
+	slog.Info("Deployment queued", "deployment-id", d.ID, "repository", d.Repository, "image-tag", d.Tag)
+	return nil
+}
+
+// next pops the oldest deployment for repository, or releases the
+// repository when nothing is left for it.
+func (q *Queue) next(repository string) *Deployment {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	deployments := q.pending[repository]
+	if len(deployments) == 0 {
+		delete(q.pending, repository)
+		delete(q.active, repository)
+		return nil
+	}
+	q.pending[repository] = deployments[1:]
+	q.size--
+	q.space.Signal()
+	return deployments[0]
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for repository := range q.ready {
+		for d := q.next(repository); d != nil; d = q.next(repository) {
+			q.run(d)
+		}
+	}
+}
+
+func (q *Queue) run(d *Deployment) {
+	log := slog.With("deployment-id", d.ID, "repository", d.Repository, "image-tag", d.Tag)
+	log.Info("Deployment started")
+	d.start()
+	err := q.handler(q.ctx, d)
+	d.finish(err)
+	if err != nil {
+		log.Error("Deployment failed", "error", err)
+		return
+	}
+	log.Info("Deployment succeeded")
+}
+
+// stop stops accepting deployments and returns the ones that have not
+// started yet.
+func (q *Queue) stop() []*Deployment {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.ready)
+	q.space.Broadcast()
+	var pending []*Deployment
+	for repository, deployments := range q.pending {
+		pending = append(pending, deployments...)
+		q.pending[repository] = nil
+	}
+	q.size = 0
+	return pending
+}
+
+// Close stops accepting deployments and waits for the queued ones to finish.
+func (q *Queue) Close() {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.ready)
+		q.space.Broadcast()
+	}
+	q.mutex.Unlock()
+	q.wg.Wait()
+	q.cancel()
+}
+
+// Shutdown stops accepting deployments, cancels the ones that have not
+// started and waits for running ones to finish. If ctx expires first, the
+// running deployments are cancelled so they roll back, and Shutdown waits
+// for the rollback before returning ctx's error.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	for _, d := range q.stop() {
+		d.cancel(ErrQueueClosed)
+		slog.Info("Deployment cancelled", "deployment-id", d.ID, "repository", d.Repository, "image-tag", d.Tag)
+	}
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	defer q.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		slog.Warn("Deadline reached, cancelling running deployments")
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
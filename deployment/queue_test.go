@@ -0,0 +1,138 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueSerializesPerRepository(t *testing.T) {
+	var mutex sync.Mutex
+	running := make(map[string]int)
+	order := make(map[string][]string)
+	overlapped := false
+	parallel := make(chan struct{}, 2)
+
+	q := NewQueue(4, 10, func(ctx context.Context, d *Deployment) error {
+		mutex.Lock()
+		running[d.Repository]++
+		if running[d.Repository] > 1 {
+			overlapped = true
+		}
+		order[d.Repository] = append(order[d.Repository], d.Tag)
+		mutex.Unlock()
+
+		parallel <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+		<-parallel
+
+		mutex.Lock()
+		running[d.Repository]--
+		mutex.Unlock()
+		if d.Tag == "bad" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	q.Start()
+
+	deployments := []*Deployment{
+		New(TriggerWebhook, "/image1", "v1"),
+		New(TriggerWebhook, "/image1", "v2"),
+		New(TriggerWebhook, "/image2", "v1"),
+		New(TriggerWebhook, "/image1", "bad"),
+	}
+	for _, d := range deployments {
+		if err := q.Enqueue(d); err != nil {
+			t.Fatalf("Failed to enqueue: %v", err)
+		}
+	}
+	q.Close()
+
+	if overlapped {
+		t.Errorf("Expected deployments of the same repository not to overlap")
+	}
+	if got := order["/image1"]; len(got) != 3 || got[0] != "v1" || got[1] != "v2" || got[2] != "bad" {
+		t.Errorf("Expected /image1 deployments in queue order, got %v", got)
+	}
+	for _, d := range deployments[:3] {
+		if record := d.Snapshot(); record.Status != StatusSucceeded {
+			t.Errorf("Expected %s:%s to succeed, got %s", d.Repository, d.Tag, record.Status)
+		}
+	}
+	if record := deployments[3].Snapshot(); record.Status != StatusFailed || record.Error != "boom" {
+		t.Errorf("Expected failed deployment to record its error, got %s %q", record.Status, record.Error)
+	}
+	if err := q.Enqueue(New(TriggerWebhook, "/image1", "v3")); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected closed queue to reject deployments, got %v", err)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := NewQueue(1, 2, func(ctx context.Context, d *Deployment) error { return nil })
+	for n := 0; n < 2; n++ {
+		if err := q.Enqueue(New(TriggerWebhook, "/image1", "v1")); err != nil {
+			t.Fatalf("Failed to enqueue: %v", err)
+		}
+	}
+	if err := q.Enqueue(New(TriggerWebhook, "/image1", "v2")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected full queue to reject deployment, got %v", err)
+	}
+	q.Start()
+	q.Close()
+}
+
+func TestQueueEnqueueWait(t *testing.T) {
+	release := make(chan struct{})
+	q := NewQueue(1, 1, func(ctx context.Context, d *Deployment) error {
+		<-release
+		return nil
+	})
+	q.Start()
+	defer q.Close()
+	for n := 0; n < 2; n++ {
+		if err := q.EnqueueWait(New(TriggerWebhook, "/image1", "v1")); err != nil {
+			t.Fatalf("Failed to enqueue: %v", err)
+		}
+	}
+	done := make(chan error)
+	go func() { done <- q.EnqueueWait(New(TriggerWebhook, "/image1", "v2")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected full queue to wait for room, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to enqueue once there was room: %v", err)
+	}
+	close(release)
+}
+
+func TestQueueShutdown(t *testing.T) {
+	started := make(chan struct{})
+	q := NewQueue(1, 10, func(ctx context.Context, d *Deployment) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	running, waiting := New(TriggerWebhook, "/image1", "v1"), New(TriggerWebhook, "/image1", "v2")
+	q.Enqueue(running)
+	q.Enqueue(waiting)
+	q.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected shutdown to hit its deadline, got %v", err)
+	}
+	if record := running.Snapshot(); record.Status != StatusFailed {
+		t.Errorf("Expected running deployment to be cancelled through its context, got %s", record.Status)
+	}
+	if record := waiting.Snapshot(); record.Status != StatusCancelled {
+		t.Errorf("Expected waiting deployment to be cancelled, got %s", record.Status)
+	}
+}
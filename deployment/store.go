@@ -0,0 +1,56 @@
+package deployment
+
+import "sync"
+
+// Store keeps the most recent deployments in memory.
+type Store struct {
+	limit       int
+	deployments map[string]*Deployment
+	order       []string
+	mutex       sync.Mutex
+}
+
+func NewStore(limit int) *Store {
+	return &Store{
+		limit:       limit,
+		deployments: make(map[string]*Deployment),
+	}
+}
+
+// Add records d, forgetting the oldest deployment once limit is reached.
+func (s *Store) Add(d *Deployment) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.order) >= s.limit {
+		delete(s.deployments, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.deployments[d.ID] = d
+	s.order = append(s.order, d.ID)
+}
+
+func (s *Store) Get(id string) (Record, bool) {
+	s.mutex.Lock()
+	d, ok := s.deployments[id]
+	s.mutex.Unlock()
+	if !ok {
+		return Record{}, false
+	}
+	return d.Snapshot(), true
+}
+
+// List returns the recorded deployments, newest first.
+func (s *Store) List() []Record {
+	s.mutex.Lock()
+	deployments := make([]*Deployment, 0, len(s.order))
+	for n := len(s.order) - 1; n >= 0; n-- {
+		deployments = append(deployments, s.deployments[s.order[n]])
+	}
+	s.mutex.Unlock()
+
+	records := make([]Record, 0, len(deployments))
+	for _, d := range deployments {
+		records = append(records, d.Snapshot())
+	}
+	return records
+}
@@ -0,0 +1,42 @@
+package deployment
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreLimit(t *testing.T) {
+	s := NewStore(2)
+	first, second, third := New(TriggerWebhook, "/image1", "v1"), New(TriggerWebhook, "/image1", "v2"), New(TriggerWebhook, "/image1", "v3")
+	s.Add(first)
+	s.Add(second)
+	s.Add(third)
+
+	if _, ok := s.Get(first.ID); ok {
+		t.Errorf("Expected oldest deployment to be forgotten")
+	}
+	records := s.List()
+	if len(records) != 2 || records[0].ID != third.ID || records[1].ID != second.ID {
+		t.Fatalf("Expected newest deployments first, got %+v", records)
+	}
+}
+
+func TestDeploymentPhases(t *testing.T) {
+	d := New(TriggerWebhook, "/image1", "v2")
+	d.SetPrevious("v1", "old")
+	d.StartPhase(PhasePull)
+	d.EndPhase(PhasePull, nil)
+	d.StartPhase(PhaseCreate)
+	d.EndPhase(PhaseCreate, errors.New("name in use"))
+
+	record := d.Snapshot()
+	if record.PreviousTag != "v1" || record.OldContainerID != "old" {
+		t.Errorf("Expected previous state to be recorded, got %+v", record)
+	}
+	if len(record.Phases) != 2 || record.Phases[0].FinishedAt == nil || record.Phases[0].Error != "" {
+		t.Fatalf("Expected finished pull phase, got %+v", record.Phases)
+	}
+	if record.Phases[1].Error != "name in use" {
+		t.Errorf("Expected create phase error, got %+v", record.Phases[1])
+	}
+}
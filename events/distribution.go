@@ -0,0 +1,76 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+// DistributionMediaType is the content type of registry v2 notifications.
+const DistributionMediaType = "application/vnd.docker.distribution.events.v1+json"
+
+const distributionActionPush = "push"
+
+// DistributionEnvelope is the notification a CNCF distribution (Docker
+// Registry v2) server posts to its configured endpoints.
+// See https://distribution.github.io/distribution/about/notifications/
+type DistributionEnvelope struct {
+	Events []DistributionEvent `json:"events"`
+}
+
+type DistributionEvent struct {
+	ID        string             `json:"id"`
+	Timestamp time.Time          `json:"timestamp"`
+	Action    string             `json:"action"`
+	Target    DistributionTarget `json:"target"`
+	Request   struct {
+		ID        string `json:"id"`
+		Addr      string `json:"addr"`
+		Host      string `json:"host"`
+		Method    string `json:"method"`
+		UserAgent string `json:"useragent"`
+	} `json:"request"`
+	Actor struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+	Source struct {
+		Addr       string `json:"addr"`
+		InstanceID string `json:"instanceID"`
+	} `json:"source"`
+}
+
+type DistributionTarget struct {
+	MediaType  string `json:"mediaType"`
+	Size       int64  `json:"size"`
+	Digest     string `json:"digest"`
+	Length     int64  `json:"length"`
+	Repository string `json:"repository"`
+	URL        string `json:"url"`
+	Tag        string `json:"tag"`
+}
+
+// IgnoreReason explains why the event should not be acted on, or returns an
+// empty string for a tagged manifest push. Blob pushes carry no tag.
+func (e *DistributionEvent) IgnoreReason() string {
+	switch {
+	case e.Action != distributionActionPush:
+		return fmt.Sprintf("unsupported action %q", e.Action)
+	case e.Target.Repository == "":
+		return "missing target.repository"
+	case e.Target.Tag == "":
+		return "missing target.tag"
+	}
+	return ""
+}
+
+// ImageEvent converts a tagged manifest push to an ImageEvent.
+func (e *DistributionEvent) ImageEvent() ImageEvent {
+	return ImageEvent{
+		ID:         e.ID,
+		Registry:   RegistryDistribution,
+		Action:     ActionPush,
+		Repository: e.Target.Repository,
+		Tag:        e.Target.Tag,
+		Digest:     e.Target.Digest,
+		Time:       e.Timestamp,
+	}
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const distributionNotification = `{
+	"events": [
+		{
+			"id": "320678d8-ca14-430f-8bb6-4ca139cd83f7",
+			"timestamp": "2016-03-09T14:44:26.402973972-08:00",
+			"action": "pull",
+			"target": {
+				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+				"digest": "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+				"repository": "hello-world",
+				"tag": "latest"
+			}
+		},
+		{
+			"id": "6e5c2e4f-5c69-4a1d-93a4-2c5e7a1f2b1e",
+			"timestamp": "2016-03-09T14:45:26.402973972-08:00",
+			"action": "push",
+			"target": {
+				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+				"size": 708,
+				"digest": "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+				"length": 708,
+				"repository": "tools/hello-world",
+				"url": "http://192.168.100.227:5000/v2/tools/hello-world/manifests/sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+				"tag": "v1.2.0"
+			},
+			"request": {
+				"id": "9d56a1a8-3d0b-4a5c-9e8b-6c0c9e1a2b3c",
+				"addr": "192.168.64.11:42961",
+				"host": "192.168.100.227:5000",
+				"method": "PUT",
+				"useragent": "docker/1.10.3"
+			},
+			"actor": {},
+			"source": {
+				"addr": "xtal.local:5000",
+				"instanceID": "a53db899-3b4b-4a62-a067-8dd013beaca4"
+			}
+		},
+		{
+			"id": "1a2b3c4d-0000-4000-8000-000000000000",
+			"action": "push",
+			"target": {
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+				"digest": "sha256:c04b14da8d1441880ed3fe6106fb2cc6fa1c9661846ac0266b8a5ec8edf37b7c",
+				"repository": "tools/hello-world"
+			}
+		}
+	]
+}`
+
+func TestDistributionEnvelope(t *testing.T) {
+	var envelope DistributionEnvelope
+	if err := json.Unmarshal([]byte(distributionNotification), &envelope); err != nil {
+		t.Fatalf("Failed to parse notification: %v", err)
+	}
+	if len(envelope.Events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(envelope.Events))
+	}
+	if reason := envelope.Events[0].IgnoreReason(); reason == "" {
+		t.Errorf("Expected pull to be ignored")
+	}
+	if reason := envelope.Events[2].IgnoreReason(); reason == "" {
+		t.Errorf("Expected blob push without tag to be ignored")
+	}
+
+	push := envelope.Events[1]
+	if reason := push.IgnoreReason(); reason != "" {
+		t.Fatalf("Expected tagged push to be deployable, got %q", reason)
+	}
+	image := push.ImageEvent()
+	if image.Registry != RegistryDistribution || image.Action != ActionPush {
+		t.Errorf("Unexpected image event %+v", image)
+	}
+	if image.Repository != "tools/hello-world" || image.Tag != "v1.2.0" || image.Digest != push.Target.Digest {
+		t.Errorf("Unexpected image event %+v", image)
+	}
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+// DockerHubEvent is the payload of a Docker Hub repository webhook, sent
+// when an image is pushed.
+// See https://docs.docker.com/docker-hub/webhooks/
+type DockerHubEvent struct {
+	CallbackURL string `json:"callback_url"`
+	PushData    struct {
+		PushedAt int64  `json:"pushed_at"`
+		Pusher   string `json:"pusher"`
+		Tag      string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Owner     string `json:"owner"`
+		RepoName  string `json:"repo_name"`
+		RepoURL   string `json:"repo_url"`
+		IsPrivate bool   `json:"is_private"`
+		Status    string `json:"status"`
+	} `json:"repository"`
+}
+
+// IgnoreReason explains why the event should not be acted on, or returns an
+// empty string for a tagged push.
+func (e *DockerHubEvent) IgnoreReason() string {
+	switch {
+	case e.Repository.RepoName == "":
+		return "missing repository.repo_name"
+	case e.PushData.Tag == "":
+		return "missing push_data.tag"
+	}
+	return ""
+}
+
+// ImageEvent converts a tagged push to an ImageEvent. Docker Hub sends no
+// delivery id or digest, so the push time identifies the push.
+func (e *DockerHubEvent) ImageEvent() ImageEvent {
+	pushedAt := time.Unix(e.PushData.PushedAt, 0).UTC()
+	return ImageEvent{
+		ID:         fmt.Sprintf("dockerhub:%s:%s@%d", e.Repository.RepoName, e.PushData.Tag, e.PushData.PushedAt),
+		Registry:   RegistryDockerHub,
+		Action:     ActionPush,
+		Repository: e.Repository.RepoName,
+		Tag:        e.PushData.Tag,
+		Time:       pushedAt,
+	}
+}
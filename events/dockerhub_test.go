@@ -0,0 +1,52 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const dockerHubPush = `{
+	"callback_url": "https://registry.hub.docker.com/u/svendowideit/testhook/hook/2141b5bi5i5b02bec211i4eeih0242eg11000a/",
+	"push_data": {
+		"pushed_at": 1417566161,
+		"pusher": "trustedbuilder",
+		"tag": "v1.0.3"
+	},
+	"repository": {
+		"comment_count": 0,
+		"date_created": 1417494799,
+		"description": "",
+		"is_official": false,
+		"is_private": true,
+		"is_trusted": true,
+		"name": "testhook",
+		"namespace": "svendowideit",
+		"owner": "svendowideit",
+		"repo_name": "svendowideit/testhook",
+		"repo_url": "https://registry.hub.docker.com/u/svendowideit/testhook/",
+		"star_count": 0,
+		"status": "Active"
+	}
+}`
+
+func TestDockerHubEvent(t *testing.T) {
+	var event DockerHubEvent
+	if err := json.Unmarshal([]byte(dockerHubPush), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	if reason := event.IgnoreReason(); reason != "" {
+		t.Fatalf("Expected push to be deployable, got %q", reason)
+	}
+	image := event.ImageEvent()
+	if image.Registry != RegistryDockerHub || image.Repository != "svendowideit/testhook" || image.Tag != "v1.0.3" {
+		t.Errorf("Unexpected image event %+v", image)
+	}
+	if image.ID == "" || image.Time.Unix() != 1417566161 {
+		t.Errorf("Expected the push to be identified by its time, got %+v", image)
+	}
+
+	event.PushData.Tag = ""
+	if reason := event.IgnoreReason(); reason == "" {
+		t.Errorf("Expected push without tag to be ignored")
+	}
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	EcrSource          = "aws.ecr"
+	EcrImageActionType = "ECR Image Action"
+
+	ActionPush   = "PUSH"
+	ActionDelete = "DELETE"
+
+	ResultSuccess = "SUCCESS"
+	ResultFailure = "FAILURE"
+)
+
+// EcrEvent is the EventBridge envelope ECR emits for image actions.
+// See https://docs.aws.amazon.com/AmazonECR/latest/userguide/ecr-eventbridge.html
+type EcrEvent struct {
+	Version    string         `json:"version"`
+	ID         string         `json:"id"`
+	DetailType string         `json:"detail-type"`
+	Source     string         `json:"source"`
+	Account    string         `json:"account"`
+	Time       time.Time      `json:"time"`
+	Region     string         `json:"region"`
+	Resources  []string       `json:"resources"`
+	Detail     EcrImageAction `json:"detail"`
+}
+
+type EcrImageAction struct {
+	Result            string `json:"result"`
+	RepositoryName    string `json:"repository-name"`
+	ImageDigest       string `json:"image-digest"`
+	ActionType        string `json:"action-type"`
+	ImageTag          string `json:"image-tag"`
+	ManifestMediaType string `json:"manifest-media-type,omitempty"`
+	ArtifactMediaType string `json:"artifact-media-type,omitempty"`
+}
+
+// IgnoreReason explains why the event should not be acted on, or returns an
+// empty string for a successful image push or delete.
+func (e *EcrEvent) IgnoreReason() string {
+	switch {
+	case e.Source != EcrSource:
+		return fmt.Sprintf("unexpected source %q", e.Source)
+	case e.DetailType != EcrImageActionType:
+		return fmt.Sprintf("unexpected detail-type %q", e.DetailType)
+	case e.Detail.ActionType != ActionPush && e.Detail.ActionType != ActionDelete:
+		return fmt.Sprintf("unsupported action-type %q", e.Detail.ActionType)
+	case e.Detail.Result != ResultSuccess:
+		return fmt.Sprintf("result %q is not a success", e.Detail.Result)
+	case e.Detail.RepositoryName == "":
+		return "missing repository-name"
+	case e.Detail.ImageTag == "":
+		return "missing image-tag"
+	}
+	return ""
+}
+
+// ImageEvent converts a successful image action to an ImageEvent.
+func (e *EcrEvent) ImageEvent() ImageEvent {
+	return ImageEvent{
+		ID:         e.ID,
+		Registry:   RegistryEcr,
+		Action:     e.Detail.ActionType,
+		Repository: e.Detail.RepositoryName,
+		Tag:        e.Detail.ImageTag,
+		Digest:     e.Detail.ImageDigest,
+		Time:       e.Time,
+	}
+}
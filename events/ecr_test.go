@@ -0,0 +1,64 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const pushEvent = `{
+	"version": "0",
+	"id": "13cde686-328b-6117-af20-0e5566167482",
+	"detail-type": "ECR Image Action",
+	"source": "aws.ecr",
+	"account": "123456789012",
+	"time": "2019-11-16T01:54:34Z",
+	"region": "us-west-2",
+	"resources": [],
+	"detail": {
+		"result": "SUCCESS",
+		"repository-name": "my-repository-name",
+		"image-digest": "sha256:7f5b2640fe6fb4f46592dfd3410c4a79dac4f89e4782432e0378abcd1234",
+		"action-type": "PUSH",
+		"image-tag": "latest"
+	}
+}`
+
+func TestEcrEventParse(t *testing.T) {
+	var event EcrEvent
+	if err := json.Unmarshal([]byte(pushEvent), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	if event.ID != "13cde686-328b-6117-af20-0e5566167482" || event.Account != "123456789012" || event.Region != "us-west-2" {
+		t.Fatalf("Unexpected envelope %+v", event)
+	}
+	if event.Detail.RepositoryName != "my-repository-name" || event.Detail.ImageTag != "latest" {
+		t.Fatalf("Unexpected detail %+v", event.Detail)
+	}
+	if reason := event.IgnoreReason(); reason != "" {
+		t.Fatalf("Expected push to be deployable, got %q", reason)
+	}
+}
+
+func TestEcrEventIgnoreReason(t *testing.T) {
+	var base EcrEvent
+	if err := json.Unmarshal([]byte(pushEvent), &base); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	testCases := []struct {
+		name   string
+		modify func(e *EcrEvent)
+	}{
+		{"failure", func(e *EcrEvent) { e.Detail.Result = ResultFailure }},
+		{"action", func(e *EcrEvent) { e.Detail.ActionType = "REPLICATE" }},
+		{"source", func(e *EcrEvent) { e.Source = "custom.ecr" }},
+		{"detail-type", func(e *EcrEvent) { e.DetailType = "ECR Image Scan" }},
+		{"untagged", func(e *EcrEvent) { e.Detail.ImageTag = "" }},
+	}
+	for _, tc := range testCases {
+		event := base
+		tc.modify(&event)
+		if event.IgnoreReason() == "" {
+			t.Errorf("%s: expected event to be ignored", tc.name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GitHub webhook event names sent in the X-GitHub-Event header for
+// published container images, and the ping sent when a webhook is created.
+const (
+	GitHubEventPackage         = "package"
+	GitHubEventRegistryPackage = "registry_package"
+	GitHubEventPing            = "ping"
+
+	gitHubActionPublished = "published"
+)
+
+// GitHubPackageEvent is the payload of the GitHub package and
+// registry_package webhook events. Only one of Package and RegistryPackage
+// is set, depending on the event.
+// See https://docs.github.com/en/webhooks/webhook-events-and-payloads#package
+type GitHubPackageEvent struct {
+	Action          string         `json:"action"`
+	Package         *GitHubPackage `json:"package"`
+	RegistryPackage *GitHubPackage `json:"registry_package"`
+}
+
+type GitHubPackage struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PackageVersion struct {
+		Version           string    `json:"version"`
+		Name              string    `json:"name"`
+		PackageURL        string    `json:"package_url"`
+		CreatedAt         time.Time `json:"created_at"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name   string `json:"name"`
+				Digest string `json:"digest"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+func (e *GitHubPackageEvent) pkg() *GitHubPackage {
+	if e.Package != nil {
+		return e.Package
+	}
+	return e.RegistryPackage
+}
+
+// IgnoreReason explains why the event should not be acted on, or returns an
+// empty string for a published container image tag.
+func (e *GitHubPackageEvent) IgnoreReason() string {
+	p := e.pkg()
+	switch {
+	case e.Action != gitHubActionPublished:
+		return fmt.Sprintf("unsupported action %q", e.Action)
+	case p == nil:
+		return "missing package"
+	case !strings.EqualFold(p.PackageType, "container") && !strings.EqualFold(p.PackageType, "docker"):
+		return fmt.Sprintf("package type %q is not a container", p.PackageType)
+	case p.Owner.Login == "" || p.Name == "":
+		return "missing package owner or name"
+	case p.PackageVersion.ContainerMetadata.Tag.Name == "":
+		return "missing container tag"
+	}
+	return ""
+}
+
+// ImageEvent converts a published container image to an ImageEvent for the
+// ghcr.io/<owner>/<name> repository. deliveryID is the X-GitHub-Delivery
+// header.
+func (e *GitHubPackageEvent) ImageEvent(deliveryID string) ImageEvent {
+	p := e.pkg()
+	tag := p.PackageVersion.ContainerMetadata.Tag
+	digest := tag.Digest
+	if digest == "" {
+		digest = p.PackageVersion.Version
+	}
+	return ImageEvent{
+		ID:         deliveryID,
+		Registry:   RegistryGhcr,
+		Action:     ActionPush,
+		Repository: strings.ToLower(p.Owner.Login + "/" + p.Name),
+		Tag:        tag.Name,
+		Digest:     digest,
+		Time:       p.PackageVersion.CreatedAt,
+	}
+}
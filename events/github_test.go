@@ -0,0 +1,65 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const gitHubPackagePublished = `{
+	"action": "published",
+	"package": {
+		"id": 1234567,
+		"name": "Sidecar",
+		"namespace": "example-org",
+		"ecosystem": "CONTAINER",
+		"package_type": "CONTAINER",
+		"html_url": "https://github.com/orgs/example-org/packages/container/package/sidecar",
+		"owner": {"login": "Example-Org", "type": "Organization"},
+		"package_version": {
+			"id": 7654321,
+			"version": "sha256:3c2f0e5a0d3e1f2b4a5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f901234",
+			"name": "sha256:3c2f0e5a0d3e1f2b4a5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f901234",
+			"created_at": "2024-07-01T10:00:00Z",
+			"package_url": "ghcr.io/example-org/sidecar:v2.1.0",
+			"container_metadata": {
+				"tag": {
+					"name": "v2.1.0",
+					"digest": "sha256:3c2f0e5a0d3e1f2b4a5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f901234"
+				},
+				"labels": {},
+				"manifest": {}
+			}
+		},
+		"registry": {"name": "GitHub CR", "type": "docker", "url": "https://ghcr.io/example-org"}
+	},
+	"repository": {"full_name": "example-org/sidecar"},
+	"sender": {"login": "octocat"}
+}`
+
+func TestGitHubPackageEvent(t *testing.T) {
+	var event GitHubPackageEvent
+	if err := json.Unmarshal([]byte(gitHubPackagePublished), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	if reason := event.IgnoreReason(); reason != "" {
+		t.Fatalf("Expected published container to be deployable, got %q", reason)
+	}
+	image := event.ImageEvent("delivery-1")
+	if image.Registry != RegistryGhcr || image.Repository != "example-org/sidecar" || image.Tag != "v2.1.0" {
+		t.Errorf("Unexpected image event %+v", image)
+	}
+	if image.ID != "delivery-1" || image.Digest == "" {
+		t.Errorf("Expected delivery id and digest, got %+v", image)
+	}
+
+	// registry_package events carry the same package under another key
+	event.RegistryPackage, event.Package = event.Package, nil
+	if reason := event.IgnoreReason(); reason != "" {
+		t.Errorf("Expected registry_package event to be deployable, got %q", reason)
+	}
+
+	event.RegistryPackage.PackageType = "npm"
+	if reason := event.IgnoreReason(); reason == "" {
+		t.Errorf("Expected npm package to be ignored")
+	}
+}
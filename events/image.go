@@ -0,0 +1,26 @@
+package events
+
+import "time"
+
+// Registries that deliver image events. Watched images name the registry
+// they are pulled from and only react to events from it.
+const (
+	RegistryEcr          = "ecr"
+	RegistryDistribution = "distribution"
+	RegistryDockerHub    = "dockerhub"
+	RegistryGhcr         = "ghcr"
+)
+
+// ImageEvent is a registry independent image push or delete that the
+// adapters for each registry's event format produce.
+type ImageEvent struct {
+	// ID identifies the delivery for deduplication, if the registry has one.
+	ID       string `json:"id,omitempty"`
+	Registry string `json:"registry"`
+	// Action is ActionPush or ActionDelete.
+	Action     string    `json:"action"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest,omitempty"`
+	Time       time.Time `json:"time"`
+}
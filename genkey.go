@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+// genkey implements the genkey command, which generates a webhook key and
+// the hash to store in the secret when secrets.hashedKeys is set. The key is
+// only ever printed here, for the caller that will use it.
+func genkey(args []string) int {
+	flags := flag.NewFlagSet("genkey", flag.ContinueOnError)
+	pepperEnv := flags.String("pepper-env", "ECR_WEBHOOK_PEPPER", "environment variable holding the pepper the receiver hashes keys with")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	key, hash, err := secrets.NewKey([]byte(os.Getenv(*pepperEnv)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "genkey: %v in %s\n", err, *pepperEnv)
+		return 1
+	}
+	fmt.Printf("key:  %s\nhash: %s\n", key, hash)
+	return 0
+}
@@ -4,6 +4,8 @@ go 1.22.2
 
 require (
 	github.com/aws/aws-sdk-go-v2/service/ecr v1.30.1
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.34.1
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.52.1
 	github.com/docker/docker v27.0.3+incompatible
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -25,7 +27,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sso v1.22.1 // indirect
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.26.2 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.30.1 // indirect
-	github.com/aws/smithy-go v1.20.3 // indirect
+	github.com/aws/smithy-go v1.20.3
 	github.com/containerd/log v0.1.0 // indirect
 	github.com/distribution/reference v0.6.0 // indirect
 	github.com/docker/go-connections v0.5.0 // indirect
@@ -2,6 +2,7 @@ package image_watcher
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,12 +14,29 @@ type WatchedImageConfig struct {
 	RepositoryUri string `yaml:"repositoryUri"`
 	// ImageTagPrefix prefix
 	ImageTagPrefix string `yaml:"imageTagPrefix"`
+	// OnDelete decides what happens when the running tag is deleted from the
+	// registry: "alert" (default) only alerts, "rollback" redeploys the
+	// previous tag and "pin" keeps the running image referenced by digest.
+	OnDelete string `yaml:"onDelete"`
+	// Registry is where the image is pulled from and which events deploy it:
+	// "ecr" (default) pulls with ECR credentials, "distribution" (a registry
+	// v2 server), "dockerhub" and "ghcr" pull without them.
+	Registry string `yaml:"registry"`
 }
+type PollingConfig struct {
+	// Interval is how often ECR is asked for the newest tag of every watched
+	// ECR image. Polling is disabled when it is zero.
+	Interval time.Duration `yaml:"interval"`
+	// MaxInterval bounds the interval while ECR throttles the poller.
+	MaxInterval time.Duration `yaml:"maxInterval"`
+}
+
 type Config struct {
 	// Port is the port on which the server listens for incoming requests.
 	// SecretName is the name of the secret in AWS Secrets Manager that contains the current key.
 	SecretName    string               `yaml:"secretName"`
 	WatchedImages []WatchedImageConfig `yaml:"watchedImages"`
+	Polling       PollingConfig        `yaml:"polling"`
 }
 
 func newConfig() *Config {
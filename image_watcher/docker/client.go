@@ -2,6 +2,7 @@ package docker
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
 
@@ -31,8 +32,8 @@ func NewDockerClient(awsClient *aws.AwsClient) *DockerClient {
 	}
 }
 
-func (d *DockerClient) StopContainer(containerID string) bool {
-	err := d.apiClient.ContainerStop(context.Background(), containerID, container.StopOptions{})
+func (d *DockerClient) StopContainer(ctx context.Context, containerID string) bool {
+	err := d.apiClient.ContainerStop(ctx, containerID, container.StopOptions{})
 	if err != nil {
 		d.log.Error("StopContainer - Failed to stop container:", "error", err)
 		return false
@@ -41,8 +42,8 @@ func (d *DockerClient) StopContainer(containerID string) bool {
 	return true
 }
 
-func (d *DockerClient) RemoveContainer(containerID string) bool {
-	err := d.apiClient.ContainerRemove(context.Background(), containerID, container.RemoveOptions{})
+func (d *DockerClient) RemoveContainer(ctx context.Context, containerID string) bool {
+	err := d.apiClient.ContainerRemove(ctx, containerID, container.RemoveOptions{})
 	if err != nil {
 		d.log.Error("RemoveContainer - Failed to remove container:", "error", err)
 		return false
@@ -51,8 +52,8 @@ func (d *DockerClient) RemoveContainer(containerID string) bool {
 	return true
 }
 
-func (d *DockerClient) StartContainer(containerID string) bool {
-	err := d.apiClient.ContainerStart(context.Background(), containerID, container.StartOptions{})
+func (d *DockerClient) StartContainer(ctx context.Context, containerID string) bool {
+	err := d.apiClient.ContainerStart(ctx, containerID, container.StartOptions{})
 	if err != nil {
 		d.log.Error("StartContainer - Failed to start container:", "error", err)
 		return false
@@ -61,8 +62,8 @@ func (d *DockerClient) StartContainer(containerID string) bool {
 	return true
 }
 
-func (d *DockerClient) CreateContainer(refString string) (string, bool) {
-	resp, err := d.apiClient.ContainerCreate(context.Background(), &container.Config{
+func (d *DockerClient) CreateContainer(ctx context.Context, refString string) (string, bool) {
+	resp, err := d.apiClient.ContainerCreate(ctx, &container.Config{
 		Image: refString,
 	}, &container.HostConfig{}, nil, nil, refString)
 	if err != nil {
@@ -73,28 +74,51 @@ func (d *DockerClient) CreateContainer(refString string) (string, bool) {
 	return resp.ID, true
 }
 
-func (d *DockerClient) PullImage(refString string) bool {
-	authStr, err := d.awsClient.GetAuthStr()
-	if err != nil {
-		d.log.Error("PullImage - Failed to get auth string:", "error", err)
-		return false
-	}
-	opts := &image.PullOptions{
-		RegistryAuth: authStr,
+// PullImage pulls refString, authenticating with the ECR token when ecrAuth
+// is set.
+func (d *DockerClient) PullImage(ctx context.Context, refString string, ecrAuth bool) bool {
+	opts := &image.PullOptions{}
+	if ecrAuth {
+		authStr, err := d.awsClient.GetAuthStr()
+		if err != nil {
+			d.log.Error("PullImage - Failed to get auth string:", "error", err)
+			return false
+		}
+		opts.RegistryAuth = authStr
 	}
 
-	res, err := d.apiClient.ImagePull(context.Background(), refString, *opts)
+	res, err := d.apiClient.ImagePull(ctx, refString, *opts)
 	if err != nil {
 		d.log.Error("PullImage - Failed to pull image:", "error", err)
 		return false
 	}
 	defer res.Close()
+	// the pull only completes once its progress stream has been consumed
+	_, err = io.Copy(io.Discard, res)
+	if err != nil {
+		d.log.Error("PullImage - Failed to pull image:", "error", err)
+		return false
+	}
 	d.log.Info("PullImage - Image pulled successfully", "image", refString)
 	return true
 }
 
-func (d *DockerClient) ListContainer() ([]types.Container, bool) {
-	containers, err := d.apiClient.ContainerList(context.Background(), container.ListOptions{All: true})
+// ContainerState returns the docker state of the container, such as
+// "running" or "exited".
+func (d *DockerClient) ContainerState(ctx context.Context, containerID string) (string, bool) {
+	resp, err := d.apiClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		d.log.Error("ContainerState - Failed to inspect container:", "error", err)
+		return "", false
+	}
+	if resp.State == nil {
+		return "", false
+	}
+	return resp.State.Status, true
+}
+
+func (d *DockerClient) ListContainer(ctx context.Context) ([]types.Container, bool) {
+	containers, err := d.apiClient.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
 		d.log.Error("ListContainer - Failed to list containers:", "error", err)
 		return nil, false
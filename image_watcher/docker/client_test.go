@@ -1,13 +1,14 @@
 package docker
 
 import (
+	"context"
 	"testing"
 
-	"ljos.app/ecr-change-receiver/image_watcher/aws"
+	"ljos.app/ecr-change-receiver/aws"
 )
 
 func TestPull(t *testing.T) {
 	awsClient := aws.NewAwsClient(aws.CreateEcrClient())
 	d := NewDockerClient(awsClient)
-	d.PullImage("dummy")
+	d.PullImage(context.Background(), "dummy", true)
 }
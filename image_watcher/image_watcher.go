@@ -1,6 +1,8 @@
 package image_watcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -9,6 +11,8 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"ljos.app/ecr-change-receiver/aws"
+	"ljos.app/ecr-change-receiver/deployment"
+	"ljos.app/ecr-change-receiver/events"
 	"ljos.app/ecr-change-receiver/image_watcher/docker"
 )
 
@@ -19,6 +23,15 @@ type PasswordPartAwsCredentials struct {
 	Type       string `json:"type"`
 	Expiration int    `json:"expiration"`
 }
+
+var (
+	ErrNotWatched   = errors.New("image is not watched")
+	ErrPullFailed   = errors.New("failed to pull image")
+	ErrStopFailed   = errors.New("failed to stop running container")
+	ErrCreateFailed = errors.New("failed to create container")
+	ErrStartFailed  = errors.New("failed to start container")
+)
+
 type ImageWatcher struct {
 	accessId      string
 	accessSecret  string
@@ -29,18 +42,49 @@ type ImageWatcher struct {
 	dockerClient *docker.DockerClient
 	mutex        sync.Mutex
 }
+
+const (
+	OnDeleteAlert    = "alert"
+	OnDeleteRollback = "rollback"
+	OnDeletePin      = "pin"
+)
+
 type Image struct {
 	RepositoryName   string
 	RepositoryUri    string
 	ImageTag         string
 	StartTime        time.Time
 	PreviousImageTag string
-	containerID      string
+	// OnDelete is the action taken when ImageTag is deleted from the registry.
+	OnDelete string
+	// TagDeletedAt is set when the registry reported ImageTag as deleted.
+	TagDeletedAt time.Time
+	// PinnedDigest is used instead of ImageTag when the container is recreated.
+	PinnedDigest string
+	// Registry is the kind of registry the image is pulled from.
+	Registry    string
+	containerID string
+}
+
+// reference returns the pullable reference for imageTag, preferring the
+// pinned digest when imageTag is the tag that got pinned.
+func (im Image) reference(imageTag string) string {
+	if im.PinnedDigest != "" && imageTag == im.ImageTag {
+		return fmt.Sprintf("%s%s@%s", im.RepositoryUri, im.RepositoryName, im.PinnedDigest)
+	}
+	return fmt.Sprintf("%s%s:%s", im.RepositoryUri, im.RepositoryName, imageTag)
 }
+
 type WatchedImage struct {
 	images map[string]Image
 }
 
+// Target is a tag to deploy to the watched entry for Prefix.
+type Target struct {
+	Prefix string
+	Tag    string
+}
+
 func (i *ImageWatcher) Close() {
 	// close the docker client
 	i.awsClient.Close()
@@ -62,11 +106,23 @@ func NewImageWatcher(region string, awsClient *aws.AwsClient) *ImageWatcher {
 	}
 }
 
+// NewStaticImageWatcher creates an image watcher for images, keyed by
+// repository name and tag prefix, without docker or AWS clients. It matches
+// events and keeps their state but cannot deploy, for testing the packages
+// that use an image watcher.
+func NewStaticImageWatcher(images map[string]map[string]Image) *ImageWatcher {
+	iw := &ImageWatcher{watchedImages: make(map[string]WatchedImage)}
+	for repository, prefixes := range images {
+		iw.watchedImages[repository] = WatchedImage{images: prefixes}
+	}
+	return iw
+}
+
 func (iw *ImageWatcher) Start() {
 	slog.Info("Starting image watcher")
 	iw.watchedImages = make(map[string]WatchedImage)
 	config := newConfig()
-	containers, ok := iw.dockerClient.ListContainer()
+	containers, ok := iw.dockerClient.ListContainer(context.Background())
 	if !ok {
 		panic("could not list containers")
 	}
@@ -85,12 +141,27 @@ func (iw *ImageWatcher) initializeWatcherImages(config *Config, containers []typ
 				images: make(map[string]Image),
 			}
 		}
+		onDelete := image.OnDelete
+		switch onDelete {
+		case OnDeleteAlert, OnDeleteRollback, OnDeletePin:
+		case "":
+			onDelete = OnDeleteAlert
+		default:
+			slog.Warn("Unknown onDelete action, falling back to alert", "image", key, "on-delete", onDelete)
+			onDelete = OnDeleteAlert
+		}
+		registry := image.Registry
+		if registry == "" {
+			registry = events.RegistryEcr
+		}
 		im := Image{
 			RepositoryName:   image.RepositoryName,
 			RepositoryUri:    image.RepositoryUri,
 			ImageTag:         "",
 			StartTime:        time.Now(),
 			PreviousImageTag: "",
+			OnDelete:         onDelete,
+			Registry:         registry,
 		}
 
 		for _, ctr := range containers {
@@ -102,6 +173,7 @@ func (iw *ImageWatcher) initializeWatcherImages(config *Config, containers []typ
 			}
 			imageTag := strings.Split(ctr.Image, ":")[1]
 			im.ImageTag = imageTag
+			im.StartTime = time.Unix(ctr.Created, 0)
 			im.containerID = ctr.ID
 			slog.Info("Found container", "container-id", ctr.ID, "image-tag", imageTag)
 		}
@@ -110,68 +182,212 @@ func (iw *ImageWatcher) initializeWatcherImages(config *Config, containers []typ
 	}
 }
 
-func (i *ImageWatcher) pullAndStartImage(watchedImage Image, image string, imageTag string) {
-	slog.Info("UpdatedImage(container not started)", "image", image, "image-tag", imageTag)
-	// pull new image and start containerID
-	//
-	refString := fmt.Sprintf("%s%s:%s", watchedImage.RepositoryUri, watchedImage.RepositoryName, imageTag)
-	ok := i.dockerClient.PullImage(refString)
+// findImage returns the prefix and state of the watched image whose tag
+// prefix matches imageTag.
+func (i *ImageWatcher) findImage(image string, imageTag string) (string, Image, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	watchedImages, ok := i.watchedImages[image]
 	if !ok {
-		slog.Error("Failed to pull image")
-		return
+		return "", Image{}, false
+	}
+	for prefix, watchedImage := range watchedImages.images {
+		if strings.HasPrefix(imageTag, prefix) {
+			return prefix, watchedImage, true
+		}
 	}
-	// start container
-	resp, ok := i.dockerClient.CreateContainer(refString)
+	return "", Image{}, false
+}
+
+// GetImage returns the state of the watched image for prefix.
+func (i *ImageWatcher) GetImage(image string, prefix string) (Image, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	watchedImage, ok := i.watchedImages[image].images[prefix]
+	return watchedImage, ok
+}
+
+func (i *ImageWatcher) storeImage(image string, prefix string, watchedImage Image) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	watchedImages, ok := i.watchedImages[image]
 	if !ok {
-		slog.Error("Failed to create container")
 		return
 	}
+	watchedImages.images[prefix] = watchedImage
+}
+
+// IsWatched reports whether a push of imageTag to image in registry would
+// be deployed.
+func (i *ImageWatcher) IsWatched(registry string, image string, imageTag string) bool {
+	_, watchedImage, ok := i.findImage(image, imageTag)
+	return ok && watchedImage.Registry == registry
+}
 
-	watchedImage.containerID = resp
-	ok = i.dockerClient.StartContainer(resp)
+// UpdateImage replaces the container of the watched image matching d.Tag and
+// records the progress on d. Callers must not update the same image
+// concurrently; the global mutex is only held while reading and storing
+// state, not during docker operations. Cancelling ctx aborts the deployment
+// and rolls back to the previous container.
+func (i *ImageWatcher) UpdateImage(ctx context.Context, d *deployment.Deployment) error {
+	image, imageTag := d.Repository, d.Tag
+	slog.Info("UpdatedImage(start)", "image", image, "image-tag", imageTag)
+	prefix, watchedImage, ok := i.findImage(image, imageTag)
+	if d.ImageTagPrefix != "" {
+		prefix = d.ImageTagPrefix
+		watchedImage, ok = i.GetImage(image, prefix)
+	}
 	if !ok {
+		slog.Info("UpdatedImage(done)", "No image found for image", image)
+		return ErrNotWatched
+	}
+	d.SetPrevious(watchedImage.ImageTag, watchedImage.containerID)
+	updated, err := i.deploy(ctx, d, watchedImage)
+	i.storeImage(image, prefix, updated)
+	if err != nil {
+		return err
+	}
+	slog.Info("UpdatedImage(done)", "image", image, "image-tag", imageTag, "container-id", updated.containerID)
+	return nil
+}
+
+// runPhase records op as phase of d, turning a failed op into err, or into
+// the context error when ctx was cancelled.
+func runPhase(ctx context.Context, d *deployment.Deployment, phase deployment.Phase, err error, op func() bool) error {
+	d.StartPhase(phase)
+	if op() {
+		err = nil
+	} else if ctx.Err() != nil {
+		err = fmt.Errorf("%w: %w", err, ctx.Err())
+	}
+	d.EndPhase(phase, err)
+	return err
+}
+
+// deploy pulls d.Tag and swaps it in for the running container. The old
+// container is only removed once the new one has started; if the new one
+// cannot be created or started, or ctx is cancelled during the swap, the old
+// container is started again and the returned image is unchanged.
+func (i *ImageWatcher) deploy(ctx context.Context, d *deployment.Deployment, watchedImage Image) (Image, error) {
+	image, imageTag := d.Repository, d.Tag
+	refString := watchedImage.reference(imageTag)
+	err := runPhase(ctx, d, deployment.PhasePull, fmt.Errorf("%w: %s", ErrPullFailed, refString), func() bool {
+		return i.dockerClient.PullImage(ctx, refString, watchedImage.Registry == events.RegistryEcr)
+	})
+	if err != nil {
+		return watchedImage, err
+	}
+	// do not start replacing the container once we have been asked to stop
+	if err := ctx.Err(); err != nil {
+		return watchedImage, err
+	}
+
+	// rolling back must still work after ctx is cancelled
+	cleanupCtx := context.WithoutCancel(ctx)
+	oldContainerID := watchedImage.containerID
+	if oldContainerID != "" {
+		slog.Info("UpdatedImage(stopping running container)", "image", image, "container-id", oldContainerID)
+		err = runPhase(ctx, d, deployment.PhaseStop, fmt.Errorf("%w: %s", ErrStopFailed, oldContainerID), func() bool {
+			return i.dockerClient.StopContainer(ctx, oldContainerID)
+		})
+		if err != nil {
+			i.restoreContainer(cleanupCtx, oldContainerID)
+			return watchedImage, err
+		}
+	}
+
+	var containerID string
+	err = runPhase(ctx, d, deployment.PhaseCreate, fmt.Errorf("%w: %s", ErrCreateFailed, refString), func() bool {
+		var ok bool
+		containerID, ok = i.dockerClient.CreateContainer(ctx, refString)
+		return ok
+	})
+	if err != nil {
+		i.restoreContainer(cleanupCtx, oldContainerID)
+		return watchedImage, err
+	}
+	d.SetContainer(containerID)
+	err = runPhase(ctx, d, deployment.PhaseStart, fmt.Errorf("%w: %s", ErrStartFailed, containerID), func() bool {
+		return i.dockerClient.StartContainer(ctx, containerID)
+	})
+	if err != nil {
+		i.dockerClient.RemoveContainer(cleanupCtx, containerID)
+		i.restoreContainer(cleanupCtx, oldContainerID)
+		return watchedImage, err
+	}
+	if oldContainerID != "" {
+		// the new container is already running, so a failed removal only
+		// leaves a stopped container behind
+		_ = runPhase(cleanupCtx, d, deployment.PhaseRemove, fmt.Errorf("failed to remove old container: %s", oldContainerID), func() bool {
+			return i.dockerClient.RemoveContainer(cleanupCtx, oldContainerID)
+		})
+	}
+
+	if imageTag != watchedImage.ImageTag {
+		watchedImage.PinnedDigest = ""
+	}
+	watchedImage.PreviousImageTag = watchedImage.ImageTag
+	watchedImage.ImageTag = imageTag
+	watchedImage.StartTime = time.Now()
+	watchedImage.TagDeletedAt = time.Time{}
+	watchedImage.containerID = containerID
+	return watchedImage, nil
+}
+
+func (i *ImageWatcher) restoreContainer(ctx context.Context, containerID string) {
+	if containerID == "" {
 		return
 	}
-	slog.Info("UpdatedImage(container started)", "image", image, "image-tag", imageTag, "container-id", watchedImage.containerID)
-	return
+	slog.Warn("Restarting previous container", "container-id", containerID)
+	if !i.dockerClient.StartContainer(ctx, containerID) {
+		slog.Error("ALERT: failed to restart previous container", "alert", true, "container-id", containerID)
+	}
 }
 
-func (i *ImageWatcher) UpdateImage(image string, imageTag string) {
+// DeleteImage handles a registry deletion of imageTag. Watched images running
+// that tag are marked as deleted, an alert is raised and their OnDelete
+// action is applied. The tags that should be redeployed as a rollback are
+// returned with the prefix of their entry; the caller is responsible for
+// deploying them.
+func (i *ImageWatcher) DeleteImage(registry string, image string, imageTag string, imageDigest string) []Target {
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
-	slog.Info("UpdatedImage(start)", "image", image, "image-tag", imageTag)
 	watchedImages, ok := i.watchedImages[image]
 	if !ok {
-		slog.Info("UpdateImage", "watchedImages", i.watchedImages)
-		return
+		slog.Info("DeleteImage(not watched)", "image", image, "image-tag", imageTag)
+		return nil
 	}
+	var rollbacks []Target
 	for prefix, watchedImage := range watchedImages.images {
-		if strings.HasPrefix(imageTag, prefix) {
-			watchedImage.PreviousImageTag = watchedImage.ImageTag
-			watchedImage.ImageTag = imageTag
-			watchedImage.StartTime = time.Now()
-			if watchedImage.containerID == "" {
-				i.pullAndStartImage(watchedImage, image, imageTag)
-				return
-			}
+		if watchedImage.ImageTag == "" || watchedImage.ImageTag != imageTag || watchedImage.Registry != registry {
+			continue
+		}
+		watchedImage.TagDeletedAt = time.Now()
+		slog.Warn("ALERT: running image tag was deleted from the registry",
+			"alert", true,
+			"image", image,
+			"image-tag", imageTag,
+			"image-digest", imageDigest,
+			"container-id", watchedImage.containerID,
+			"on-delete", watchedImage.OnDelete)
 
-			slog.Info("UpdatedImage(container already started)", "image", image, "image-tag", imageTag, "container-id", watchedImage.containerID)
-			watchedImages.images[prefix] = watchedImage
-			i.watchedImages[image] = watchedImages
-			slog.Info("UpdatedImage(done)", "image", image, "image-tag", imageTag)
-			// pull new image and restart container
-			ok := i.dockerClient.StartContainer(watchedImage.containerID)
-			if !ok {
-				return
+		switch watchedImage.OnDelete {
+		case OnDeleteRollback:
+			if watchedImage.PreviousImageTag == "" {
+				slog.Error("DeleteImage - No previous image tag to roll back to", "image", image, "image-tag", imageTag)
+				break
 			}
-			ok = i.dockerClient.RemoveContainer(watchedImage.containerID)
-			if !ok {
-				return
+			slog.Info("DeleteImage - Rolling back", "image", image, "image-tag", watchedImage.PreviousImageTag)
+			rollbacks = append(rollbacks, Target{Prefix: prefix, Tag: watchedImage.PreviousImageTag})
+		case OnDeletePin:
+			if imageDigest == "" {
+				slog.Error("DeleteImage - No digest to pin", "image", image, "image-tag", imageTag)
+				break
 			}
-			i.pullAndStartImage(watchedImage, image, imageTag)
-			slog.Info("UpdatedImage(done)", "image", image, "image-tag", imageTag)
-			return
+			watchedImage.PinnedDigest = imageDigest
+			slog.Info("DeleteImage - Pinned running digest", "image", image, "image-digest", imageDigest)
 		}
+		watchedImages.images[prefix] = watchedImage
 	}
-	slog.Info("UpdatedImage(done)", "No image found for image", image)
+	return rollbacks
 }
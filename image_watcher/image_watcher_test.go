@@ -4,11 +4,13 @@ import (
 	"testing"
 
 	"github.com/docker/docker/api/types"
+	"ljos.app/ecr-change-receiver/events"
 )
 
 type expected struct {
-	image string
-	tag   string
+	image  string
+	prefix string
+	tag    string
 }
 
 func TestImageWatcherInitialize(t *testing.T) {
@@ -75,17 +77,105 @@ func TestImageWatcherInitialize(t *testing.T) {
 		Mounts:          []types.MountPoint{},
 	}
 	testCases := []expected{
-		{"/image1:ljos-dev", ""},
-		{"/image1:staging", "staging-1.1.0"},
-		{"/some-other-image:master", ""},
+		{"/image1", "ljos-dev", ""},
+		{"/image1", "staging", "staging-1.1.0"},
+		{"/some-other-image", "master", ""},
 	}
 	iw.initializeWatcherImages(config, containers)
-	if len(iw.watchedImages) != 3 {
-		t.Errorf("Expected 3 watched image, got %d", len(iw.watchedImages))
+	if len(iw.watchedImages) != 2 {
+		t.Errorf("Expected 2 watched repositories, got %d", len(iw.watchedImages))
 	}
 	for _, tc := range testCases {
-		if _, ok := iw.watchedImages[tc.image]; !ok {
-			t.Errorf("Expected to find /image1:ljos-dev")
+		im, ok := iw.watchedImages[tc.image].images[tc.prefix]
+		if !ok {
+			t.Errorf("Expected to find %s:%s", tc.image, tc.prefix)
+			continue
 		}
+		if im.ImageTag != tc.tag {
+			t.Errorf("Expected %s:%s to run %q, got %q", tc.image, tc.prefix, tc.tag, im.ImageTag)
+		}
+		if im.OnDelete != OnDeleteAlert {
+			t.Errorf("Expected %s:%s to default to %q, got %q", tc.image, tc.prefix, OnDeleteAlert, im.OnDelete)
+		}
+	}
+}
+
+func TestImageWatcherDeleteImage(t *testing.T) {
+	iw := &ImageWatcher{}
+	iw.watchedImages = map[string]WatchedImage{
+		"/image1": {images: map[string]Image{
+			"staging": {RepositoryName: "/image1", ImageTag: "staging-1.1.0", OnDelete: OnDeletePin, Registry: events.RegistryEcr, containerID: "aa1234o"},
+			"prod":    {RepositoryName: "/image1", ImageTag: "prod-1.0.0", OnDelete: OnDeleteAlert, Registry: events.RegistryEcr, containerID: "bb1234o"},
+		}},
+	}
+
+	iw.DeleteImage(events.RegistryEcr, "/image1", "staging-1.0.0", "sha256:old")
+	if !iw.watchedImages["/image1"].images["staging"].TagDeletedAt.IsZero() {
+		t.Fatalf("Expected deleting a tag that is not running to be ignored")
+	}
+
+	iw.DeleteImage(events.RegistryDistribution, "/image1", "staging-1.1.0", "sha256:abc")
+	if !iw.watchedImages["/image1"].images["staging"].TagDeletedAt.IsZero() {
+		t.Fatalf("Expected deletes from another registry to be ignored")
+	}
+
+	iw.DeleteImage(events.RegistryEcr, "/image1", "staging-1.1.0", "sha256:abc")
+	staging := iw.watchedImages["/image1"].images["staging"]
+	if staging.TagDeletedAt.IsZero() {
+		t.Errorf("Expected deletion of running tag to be recorded")
+	}
+	if staging.PinnedDigest != "sha256:abc" {
+		t.Errorf("Expected running digest to be pinned, got %q", staging.PinnedDigest)
+	}
+	if ref := staging.reference("staging-1.1.0"); ref != "/image1@sha256:abc" {
+		t.Errorf("Expected pinned reference, got %q", ref)
+	}
+
+	iw.DeleteImage(events.RegistryEcr, "/image1", "prod-1.0.0", "sha256:def")
+	prod := iw.watchedImages["/image1"].images["prod"]
+	if prod.TagDeletedAt.IsZero() || prod.PinnedDigest != "" {
+		t.Errorf("Expected alert-only deletion to be recorded without pinning, got %+v", prod)
+	}
+}
+
+func TestImageWatcherDeleteImageRollsBackMatchedEntry(t *testing.T) {
+	iw := &ImageWatcher{}
+	iw.watchedImages = map[string]WatchedImage{
+		"/image1": {images: map[string]Image{
+			// both prefixes match the v1 tags
+			"v":  {RepositoryName: "/image1", ImageTag: "v1.1", PreviousImageTag: "v1.0", OnDelete: OnDeleteRollback, Registry: events.RegistryEcr},
+			"v1": {RepositoryName: "/image1", ImageTag: "v1.2", PreviousImageTag: "v1.1", OnDelete: OnDeleteRollback, Registry: events.RegistryEcr},
+		}},
+	}
+	targets := iw.DeleteImage(events.RegistryEcr, "/image1", "v1.1", "sha256:abc")
+	if len(targets) != 1 || targets[0] != (Target{Prefix: "v", Tag: "v1.0"}) {
+		t.Errorf("Expected a rollback of the entry running the deleted tag, got %+v", targets)
+	}
+}
+
+func TestImageWatcherStatuses(t *testing.T) {
+	iw := &ImageWatcher{}
+	iw.watchedImages = map[string]WatchedImage{
+		"/image2": {images: map[string]Image{
+			"master": {RepositoryUri: "987654321023.dkr.ecr.eu-north-1.amazonaws.com", ImageTag: "master-3"},
+		}},
+		"/image1": {images: map[string]Image{
+			"staging": {RepositoryUri: "123456789013.dkr.ecr.us-west-2.amazonaws.com", ImageTag: "staging-1.1.0", PreviousImageTag: "staging-1.0.0", containerID: "aa1234o"},
+			"prod":    {RepositoryUri: "123456789013.dkr.ecr.us-west-2.amazonaws.com"},
+		}},
+	}
+
+	statuses := iw.imageStatuses()
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 statuses, got %d", len(statuses))
+	}
+	order := []string{"/image1:prod", "/image1:staging", "/image2:master"}
+	for n, status := range statuses {
+		if got := status.RepositoryName + ":" + status.ImageTagPrefix; got != order[n] {
+			t.Errorf("Expected %s at %d, got %s", order[n], n, got)
+		}
+	}
+	if statuses[1].ContainerID != "aa1234o" || statuses[1].PreviousImageTag != "staging-1.0.0" {
+		t.Errorf("Expected staging state to be copied, got %+v", statuses[1])
 	}
 }
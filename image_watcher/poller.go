@@ -0,0 +1,260 @@
+package image_watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"ljos.app/ecr-change-receiver/events"
+)
+
+// Dispatch hands an image event found by the poller to the deployment
+// pipeline, the same path webhook events take.
+type Dispatch func(event events.ImageEvent) error
+
+type imageDescriber interface {
+	DescribeImages(ctx context.Context, params *ecr.DescribeImagesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error)
+}
+
+// registryID matches the account of an ECR repository URI.
+var registryID = regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.`)
+
+// isThrottled reports whether err is ECR asking the caller to slow down.
+var isThrottled = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+// Poller periodically asks ECR for the newest tag of every watched ECR image
+// and dispatches a push event when it is not the one running, for
+// environments without an EventBridge rule.
+type Poller struct {
+	watcher     *ImageWatcher
+	client      imageDescriber
+	dispatch    Dispatch
+	interval    time.Duration
+	maxInterval time.Duration
+	// newest is the digest last found for each watched image and prefix, so
+	// a tag is only dispatched once even when it is rolled back manually.
+	// Until a prefix is first polled, tags pushed before its container was
+	// created count as seen, so a restart does not undo a rollback either.
+	newest map[string]string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// watch is a watched ECR image prefix as seen at the start of a poll.
+type watch struct {
+	image        string
+	prefix       string
+	runningTag   string
+	runningSince time.Time
+}
+
+// NewPoller creates a poller that dispatches to dispatch, or returns nil
+// when polling is not configured.
+func (iw *ImageWatcher) NewPoller(dispatch Dispatch) *Poller {
+	config := newConfig().Polling
+	if config.Interval <= 0 {
+		return nil
+	}
+	if config.MaxInterval < config.Interval {
+		config.MaxInterval = 10 * config.Interval
+	}
+	return &Poller{
+		watcher:     iw,
+		client:      iw.awsClient,
+		dispatch:    dispatch,
+		interval:    config.Interval,
+		maxInterval: config.MaxInterval,
+		newest:      make(map[string]string),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start polls in the background until Stop is called. It must be called
+// after the image watcher has started.
+func (p *Poller) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	slog.Info("Polling ECR for new image tags", "interval", p.interval)
+}
+
+// Stop ends polling and waits for a running poll, or until ctx is done.
+func (p *Poller) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Poller) run(ctx context.Context) {
+	defer close(p.done)
+	interval := p.interval
+	for {
+		if p.poll(ctx) {
+			interval = min(2*interval, p.maxInterval)
+			slog.Warn("ECR is throttling the poller, slowing down", "interval", interval)
+		} else {
+			interval = p.interval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll checks every watched ECR repository once and reports whether ECR
+// throttled it, in which case the remaining repositories wait for the next
+// poll.
+func (p *Poller) poll(ctx context.Context) bool {
+	for repository, watches := range p.watches() {
+		images, err := p.describeImages(ctx, repository)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			if isThrottled.IsErrorThrottle(err) == awssdk.TrueTernary {
+				return true
+			}
+			slog.Error("Failed to describe images", "image", repository, "error", err)
+			continue
+		}
+		for _, w := range watches {
+			p.check(w, images)
+		}
+	}
+	return false
+}
+
+// watches groups the watched ECR images by repository so every repository
+// is described once per poll.
+func (p *Poller) watches() map[string][]watch {
+	p.watcher.mutex.Lock()
+	defer p.watcher.mutex.Unlock()
+	watches := make(map[string][]watch)
+	for image, watchedImages := range p.watcher.watchedImages {
+		for prefix, watchedImage := range watchedImages.images {
+			if watchedImage.Registry != events.RegistryEcr {
+				continue
+			}
+			// a deleted or pinned tag stays until someone deploys another one,
+			// as the onDelete action decided
+			if !watchedImage.TagDeletedAt.IsZero() || watchedImage.PinnedDigest != "" {
+				continue
+			}
+			watches[image] = append(watches[image], watch{
+				image:        image,
+				prefix:       prefix,
+				runningTag:   watchedImage.ImageTag,
+				runningSince: watchedImage.StartTime,
+			})
+		}
+	}
+	return watches
+}
+
+func (p *Poller) describeImages(ctx context.Context, image string) ([]ecrtypes.ImageDetail, error) {
+	watchedImage, ok := p.anyImage(image)
+	if !ok {
+		return nil, ErrNotWatched
+	}
+	input := &ecr.DescribeImagesInput{
+		RepositoryName: awssdk.String(strings.TrimPrefix(image, "/")),
+		Filter:         &ecrtypes.DescribeImagesFilter{TagStatus: ecrtypes.TagStatusTagged},
+	}
+	if match := registryID.FindStringSubmatch(watchedImage.RepositoryUri); match != nil {
+		input.RegistryId = awssdk.String(match[1])
+	}
+	var images []ecrtypes.ImageDetail
+	paginator := ecr.NewDescribeImagesPaginator(p.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, page.ImageDetails...)
+	}
+	return images, nil
+}
+
+func (p *Poller) anyImage(image string) (Image, bool) {
+	p.watcher.mutex.Lock()
+	defer p.watcher.mutex.Unlock()
+	for _, watchedImage := range p.watcher.watchedImages[image].images {
+		return watchedImage, true
+	}
+	return Image{}, false
+}
+
+// check dispatches the newest tag matching the prefix of w when it changed
+// since the last poll and is not the running tag. On the first poll the tag
+// must also be newer than the running container.
+func (p *Poller) check(w watch, images []ecrtypes.ImageDetail) {
+	tag, image, ok := newestTag(images, w.prefix)
+	if !ok {
+		return
+	}
+	digest := awssdk.ToString(image.ImageDigest)
+	key := w.image + "|" + w.prefix
+	last, polled := p.newest[key]
+	if last == digest {
+		return
+	}
+	p.newest[key] = digest
+	if tag == w.runningTag {
+		return
+	}
+	if !polled && w.runningTag != "" && !awssdk.ToTime(image.ImagePushedAt).After(w.runningSince) {
+		slog.Info("Poller leaves older image tag for the running container", "image", w.image, "image-tag", tag, "running-tag", w.runningTag)
+		return
+	}
+	repository := strings.TrimPrefix(w.image, "/")
+	slog.Info("Poller found new image tag", "image", w.image, "image-tag", tag, "running-tag", w.runningTag)
+	err := p.dispatch(events.ImageEvent{
+		ID:         fmt.Sprintf("poll:%s:%s@%s", repository, tag, digest),
+		Registry:   events.RegistryEcr,
+		Action:     events.ActionPush,
+		Repository: repository,
+		Tag:        tag,
+		Digest:     digest,
+		Time:       awssdk.ToTime(image.ImagePushedAt),
+	})
+	if err != nil {
+		// try again on the next poll
+		delete(p.newest, key)
+		slog.Error("Failed to dispatch polled image", "image", w.image, "image-tag", tag, "error", err)
+	}
+}
+
+// newestTag returns the most recently pushed tag starting with prefix.
+func newestTag(images []ecrtypes.ImageDetail, prefix string) (string, ecrtypes.ImageDetail, bool) {
+	var newest ecrtypes.ImageDetail
+	var newestTag string
+	for _, image := range images {
+		pushedAt := awssdk.ToTime(image.ImagePushedAt)
+		for _, tag := range image.ImageTags {
+			if !strings.HasPrefix(tag, prefix) {
+				continue
+			}
+			newestPushedAt := awssdk.ToTime(newest.ImagePushedAt)
+			if newestTag == "" || pushedAt.After(newestPushedAt) || (pushedAt.Equal(newestPushedAt) && tag > newestTag) {
+				newest, newestTag = image, tag
+			}
+		}
+	}
+	return newestTag, newest, newestTag != ""
+}
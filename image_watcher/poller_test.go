@@ -0,0 +1,155 @@
+package image_watcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/smithy-go"
+	"ljos.app/ecr-change-receiver/events"
+)
+
+type fakeDescriber struct {
+	images []ecrtypes.ImageDetail
+	err    error
+	inputs []*ecr.DescribeImagesInput
+}
+
+func (f *fakeDescriber) DescribeImages(ctx context.Context, params *ecr.DescribeImagesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error) {
+	f.inputs = append(f.inputs, params)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ecr.DescribeImagesOutput{ImageDetails: f.images}, nil
+}
+
+func imageDetail(digest string, pushedAt time.Time, tags ...string) ecrtypes.ImageDetail {
+	return ecrtypes.ImageDetail{ImageDigest: &digest, ImagePushedAt: &pushedAt, ImageTags: tags}
+}
+
+func TestPollerDispatchesNewestTag(t *testing.T) {
+	base := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	iw := &ImageWatcher{watchedImages: map[string]WatchedImage{
+		"/image1": {images: map[string]Image{
+			"staging": {RepositoryName: "/image1", RepositoryUri: "123456789012.dkr.ecr.eu-north-1.amazonaws.com", ImageTag: "staging-1.0.0", Registry: events.RegistryEcr},
+			"prod":    {RepositoryName: "/image1", RepositoryUri: "123456789012.dkr.ecr.eu-north-1.amazonaws.com", ImageTag: "prod-1.0.0", Registry: events.RegistryEcr},
+		}},
+		"/tools": {images: map[string]Image{
+			"v": {RepositoryName: "/tools", ImageTag: "v1", Registry: events.RegistryDistribution},
+		}},
+	}}
+	client := &fakeDescriber{images: []ecrtypes.ImageDetail{
+		imageDetail("sha256:a", base, "staging-1.0.0", "prod-1.0.0"),
+		imageDetail("sha256:b", base.Add(time.Hour), "staging-1.1.0"),
+		imageDetail("sha256:c", base.Add(-time.Hour), "staging-0.9.0"),
+	}}
+	var dispatched []events.ImageEvent
+	p := &Poller{
+		watcher: iw,
+		client:  client,
+		dispatch: func(event events.ImageEvent) error {
+			dispatched = append(dispatched, event)
+			return nil
+		},
+		newest: make(map[string]string),
+	}
+
+	if throttled := p.poll(context.Background()); throttled {
+		t.Fatalf("Expected poll not to be throttled")
+	}
+	if len(client.inputs) != 1 {
+		t.Fatalf("Expected one DescribeImages call for the ECR repository, got %d", len(client.inputs))
+	}
+	if input := client.inputs[0]; awssdk.ToString(input.RepositoryName) != "image1" || awssdk.ToString(input.RegistryId) != "123456789012" {
+		t.Errorf("Unexpected DescribeImages input %+v", input)
+	}
+	if len(dispatched) != 1 {
+		t.Fatalf("Expected only the new staging tag to be dispatched, got %+v", dispatched)
+	}
+	event := dispatched[0]
+	if event.Repository != "image1" || event.Tag != "staging-1.1.0" || event.Digest != "sha256:b" || event.Registry != events.RegistryEcr {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	// a manual rollback must not be undone by the next poll
+	p.poll(context.Background())
+	if len(dispatched) != 1 {
+		t.Errorf("Expected an unchanged newest tag not to be dispatched again, got %+v", dispatched)
+	}
+}
+
+func TestPollerBacksOffWhenThrottled(t *testing.T) {
+	iw := &ImageWatcher{watchedImages: map[string]WatchedImage{
+		"/image1": {images: map[string]Image{"v": {RepositoryName: "/image1", Registry: events.RegistryEcr}}},
+	}}
+	client := &fakeDescriber{err: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}}
+	p := &Poller{watcher: iw, client: client, newest: make(map[string]string)}
+	if throttled := p.poll(context.Background()); !throttled {
+		t.Errorf("Expected throttling to be reported")
+	}
+}
+
+func TestPollerSkipsDeletedAndPinnedTags(t *testing.T) {
+	base := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	iw := &ImageWatcher{watchedImages: map[string]WatchedImage{
+		"/image1": {images: map[string]Image{
+			"staging": {RepositoryName: "/image1", ImageTag: "staging-1.1.0", TagDeletedAt: base, Registry: events.RegistryEcr},
+			"prod":    {RepositoryName: "/image1", ImageTag: "prod-1.1.0", TagDeletedAt: base, PinnedDigest: "sha256:b", Registry: events.RegistryEcr},
+		}},
+	}}
+	// the deleted tags are gone, so an older tag is the newest one left
+	client := &fakeDescriber{images: []ecrtypes.ImageDetail{
+		imageDetail("sha256:a", base.Add(-time.Hour), "staging-1.0.0", "prod-1.0.0"),
+	}}
+	var dispatched []events.ImageEvent
+	p := &Poller{
+		watcher: iw,
+		client:  client,
+		dispatch: func(event events.ImageEvent) error {
+			dispatched = append(dispatched, event)
+			return nil
+		},
+		newest: make(map[string]string),
+	}
+	p.poll(context.Background())
+	if len(dispatched) != 0 {
+		t.Errorf("Expected no rollback of deleted or pinned tags, got %+v", dispatched)
+	}
+}
+
+func TestPollerKeepsRollbackAfterRestart(t *testing.T) {
+	base := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	iw := &ImageWatcher{watchedImages: map[string]WatchedImage{
+		"/image1": {images: map[string]Image{
+			// rolled back to 1.0.0 after 1.1.0 was pushed
+			"staging": {RepositoryName: "/image1", ImageTag: "staging-1.0.0", StartTime: base.Add(2 * time.Hour), Registry: events.RegistryEcr},
+		}},
+	}}
+	client := &fakeDescriber{images: []ecrtypes.ImageDetail{
+		imageDetail("sha256:a", base, "staging-1.0.0"),
+		imageDetail("sha256:b", base.Add(time.Hour), "staging-1.1.0"),
+	}}
+	var dispatched []events.ImageEvent
+	p := &Poller{
+		watcher: iw,
+		client:  client,
+		dispatch: func(event events.ImageEvent) error {
+			dispatched = append(dispatched, event)
+			return nil
+		},
+		newest: make(map[string]string),
+	}
+	p.poll(context.Background())
+	if len(dispatched) != 0 {
+		t.Fatalf("Expected a tag older than the running container not to be dispatched, got %+v", dispatched)
+	}
+
+	client.images = append(client.images, imageDetail("sha256:c", base.Add(3*time.Hour), "staging-1.2.0"))
+	p.poll(context.Background())
+	if len(dispatched) != 1 || dispatched[0].Tag != "staging-1.2.0" {
+		t.Errorf("Expected the tag pushed after the rollback to be dispatched, got %+v", dispatched)
+	}
+}
@@ -0,0 +1,75 @@
+package image_watcher
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// ImageStatus is the live state of one watched repository and tag prefix.
+type ImageStatus struct {
+	RepositoryName   string     `json:"repositoryName"`
+	ImageTagPrefix   string     `json:"imageTagPrefix"`
+	RepositoryUri    string     `json:"repositoryUri"`
+	ImageTag         string     `json:"imageTag"`
+	PreviousImageTag string     `json:"previousImageTag"`
+	StartTime        time.Time  `json:"startTime"`
+	OnDelete         string     `json:"onDelete"`
+	PinnedDigest     string     `json:"pinnedDigest,omitempty"`
+	TagDeletedAt     *time.Time `json:"tagDeletedAt,omitempty"`
+	ContainerID      string     `json:"containerId,omitempty"`
+	// ContainerState is the docker state of ContainerID, or "unknown" if it
+	// could not be inspected.
+	ContainerState string `json:"containerState,omitempty"`
+}
+
+// ImageStatuses lists every watched repository and tag prefix, sorted by
+// repository and prefix, together with the state of its container.
+func (i *ImageWatcher) ImageStatuses(ctx context.Context) []ImageStatus {
+	statuses := i.imageStatuses()
+	for n := range statuses {
+		if statuses[n].ContainerID == "" {
+			continue
+		}
+		state, ok := i.dockerClient.ContainerState(ctx, statuses[n].ContainerID)
+		if !ok {
+			state = "unknown"
+		}
+		statuses[n].ContainerState = state
+	}
+	return statuses
+}
+
+// imageStatuses copies the watched images without contacting docker.
+func (i *ImageWatcher) imageStatuses() []ImageStatus {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	statuses := []ImageStatus{}
+	for repository, watchedImage := range i.watchedImages {
+		for prefix, image := range watchedImage.images {
+			status := ImageStatus{
+				RepositoryName:   repository,
+				ImageTagPrefix:   prefix,
+				RepositoryUri:    image.RepositoryUri,
+				ImageTag:         image.ImageTag,
+				PreviousImageTag: image.PreviousImageTag,
+				StartTime:        image.StartTime,
+				OnDelete:         image.OnDelete,
+				PinnedDigest:     image.PinnedDigest,
+				ContainerID:      image.containerID,
+			}
+			if !image.TagDeletedAt.IsZero() {
+				deletedAt := image.TagDeletedAt
+				status.TagDeletedAt = &deletedAt
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(a, b int) bool {
+		if statuses[a].RepositoryName != statuses[b].RepositoryName {
+			return statuses[a].RepositoryName < statuses[b].RepositoryName
+		}
+		return statuses[a].ImageTagPrefix < statuses[b].ImageTagPrefix
+	})
+	return statuses
+}
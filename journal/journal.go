@@ -0,0 +1,206 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ljos.app/ecr-change-receiver/events"
+)
+
+// Outcomes of journaled requests besides the webhook result statuses.
+const (
+	OutcomeRejected = "rejected"
+	OutcomeFailed   = "failed"
+)
+
+// rotatedTimeFormat sorts rotated files in the order they were written.
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+type Config struct {
+	// Path is the file entries are appended to. The journal is disabled when
+	// it is empty.
+	Path string `yaml:"path"`
+	// MaxSize is the size in bytes at which the file is rotated.
+	MaxSize int64 `yaml:"maxSize"`
+	// MaxFiles is how many rotated files are kept besides the current one.
+	MaxFiles int `yaml:"maxFiles"`
+}
+
+func (c *Config) SetDefaults() {
+	if c.MaxSize <= 0 {
+		c.MaxSize = 10 << 20
+	}
+	if c.MaxFiles <= 0 {
+		c.MaxFiles = 5
+	}
+}
+
+// Entry records one received event and what became of it.
+type Entry struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	// Source is the endpoint or event source, such as "update" or "sqs".
+	Source   string `json:"source"`
+	SourceIP string `json:"sourceIp,omitempty"`
+	Caller   string `json:"caller,omitempty"`
+	// Auth is "ok" or the reason authentication failed, and empty for
+	// sources without authentication.
+	Auth string `json:"auth,omitempty"`
+	// Outcome is the webhook result status, OutcomeRejected when the request
+	// was refused or OutcomeFailed when it could not be processed. Entries
+	// from the "deployment" source hold the final status of the deployment
+	// in DeploymentIDs instead.
+	Outcome       string   `json:"outcome"`
+	Reason        string   `json:"reason,omitempty"`
+	DeploymentIDs []string `json:"deploymentIds,omitempty"`
+	// Event is the image event that was acted on. It is missing for requests
+	// that were rejected or ignored before becoming an image event, and for
+	// deployment entries.
+	Event *events.ImageEvent `json:"event,omitempty"`
+}
+
+// Journal appends entries as JSON lines to a file that is rotated by size.
+// Every entry is synced to disk before Append returns.
+type Journal struct {
+	config Config
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// Open opens the journal file for appending, creating it and its directory
+// when needed.
+func Open(config Config) (*Journal, error) {
+	j := &Journal{config: config}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	if err := os.MkdirAll(filepath.Dir(j.config.Path), 0o750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file, j.size = file, info.Size()
+	return nil
+}
+
+// Append writes entry as one line, rotating the file first when the line
+// would take it past the maximum size.
+func (j *Journal) Append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.closed {
+		return os.ErrClosed
+	}
+	if j.file == nil {
+		// reopening failed after an earlier rotation
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+	if j.size > 0 && j.size+int64(len(line)) > j.config.MaxSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// rotate renames the current file with its rotation time, removes the
+// oldest rotated files and starts a new file. When renaming fails, the
+// current file is reopened and keeps growing, so no entries are lost.
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		slog.Error("Failed to close journal", "file", j.config.Path, "error", err)
+	}
+	j.file = nil
+	if err := j.renameCurrent(); err != nil {
+		slog.Error("Failed to rotate journal", "file", j.config.Path, "error", err)
+	}
+	return j.open()
+}
+
+// renameCurrent renames the current file with the rotation time and removes
+// the oldest rotated files.
+func (j *Journal) renameCurrent() error {
+	ext := filepath.Ext(j.config.Path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(j.config.Path, ext), time.Now().UTC().Format(rotatedTimeFormat), ext)
+	if err := os.Rename(j.config.Path, rotated); err != nil {
+		return err
+	}
+	files, err := rotatedFiles(j.config.Path)
+	if err != nil {
+		return err
+	}
+	for len(files) > j.config.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			slog.Error("Failed to remove rotated journal", "file", files[0], "error", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.closed = true
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// rotatedFiles lists the rotated files of path, oldest first.
+func rotatedFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	files, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Files lists the rotated files of path, oldest first, followed by path
+// itself when it exists.
+func Files(path string) ([]string, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
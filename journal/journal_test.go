@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ljos.app/ecr-change-receiver/events"
+)
+
+func TestJournalRotatesAndReadsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal", "events.jsonl")
+	config := Config{Path: path, MaxSize: 300, MaxFiles: 2}
+	j, err := Open(config)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	base := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		err := j.Append(Entry{
+			ReceivedAt: base.Add(time.Duration(i) * time.Minute),
+			Source:     "update",
+			Outcome:    "queued",
+			Event:      &events.ImageEvent{Registry: events.RegistryEcr, Action: events.ActionPush, Repository: "image1", Tag: "v1"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to append entry %d: %v", i, err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Failed to close journal: %v", err)
+	}
+
+	files, err := Files(path)
+	if err != nil {
+		t.Fatalf("Failed to list journal files: %v", err)
+	}
+	if len(files) != 3 || files[2] != path {
+		t.Fatalf("Expected 2 rotated files and the current one, got %v", files)
+	}
+	entries, err := ReadFiles(files, Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if len(entries) == 0 || len(entries) >= 10 {
+		t.Fatalf("Expected the oldest entries to be rotated away, got %d entries", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i].ReceivedAt.After(entries[i-1].ReceivedAt) {
+			t.Fatalf("Expected entries in journal order, got %v before %v", entries[i-1].ReceivedAt, entries[i].ReceivedAt)
+		}
+	}
+	if last := entries[len(entries)-1]; !last.ReceivedAt.Equal(base.Add(9 * time.Minute)) {
+		t.Errorf("Expected the newest entry last, got %v", last.ReceivedAt)
+	}
+}
+
+func TestJournalKeepsAppendingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j, err := Open(Config{Path: path, MaxSize: 100, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	defer j.Close()
+	entry := Entry{ReceivedAt: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC), Source: "update", Outcome: "queued"}
+	if err := j.Append(entry); err != nil {
+		t.Fatalf("Failed to append entry: %v", err)
+	}
+	// renaming a file that is gone fails
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove journal file: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := j.Append(entry); err != nil {
+			t.Fatalf("Failed to append entry %d after a failed rotation: %v", i, err)
+		}
+	}
+	entries, err := ReadFiles([]string{path}, Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Errorf("Expected entries after the failed rotation to be written")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	base := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	entry := Entry{
+		ReceivedAt: base,
+		Source:     "sns",
+		Outcome:    "queued",
+		Event:      &events.ImageEvent{ID: "event-1", Repository: "image1", Tag: "staging-1.2.0"},
+	}
+	tests := map[string]struct {
+		filter Filter
+		match  bool
+	}{
+		"empty":           {Filter{}, true},
+		"in range":        {Filter{Since: base, Until: base.Add(time.Minute)}, true},
+		"before range":    {Filter{Since: base.Add(time.Second)}, false},
+		"until exclusive": {Filter{Until: base}, false},
+		"source":          {Filter{Source: "update"}, false},
+		"outcome":         {Filter{Outcome: "queued"}, true},
+		"repository":      {Filter{Repository: "image1", TagPrefix: "staging"}, true},
+		"tag prefix":      {Filter{TagPrefix: "prod"}, false},
+		"event id":        {Filter{EventID: "event-2"}, false},
+	}
+	for name, test := range tests {
+		if got := test.filter.Match(entry); got != test.match {
+			t.Errorf("%s: Match = %v, expected %v", name, got, test.match)
+		}
+	}
+	if (Filter{Repository: "image1"}).Match(Entry{Outcome: OutcomeRejected}) {
+		t.Errorf("Expected entries without event not to match an event filter")
+	}
+}
@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxLineSize bounds a journal line, which holds at most one event.
+const maxLineSize = 4 << 20
+
+// Filter selects journal entries. Zero fields match every entry.
+type Filter struct {
+	Since      time.Time
+	Until      time.Time
+	Source     string
+	Outcome    string
+	Repository string
+	TagPrefix  string
+	EventID    string
+}
+
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case !f.Since.IsZero() && e.ReceivedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.ReceivedAt.Before(f.Until):
+		return false
+	case f.Source != "" && e.Source != f.Source:
+		return false
+	case f.Outcome != "" && e.Outcome != f.Outcome:
+		return false
+	}
+	if f.Repository == "" && f.TagPrefix == "" && f.EventID == "" {
+		return true
+	}
+	return e.Event != nil &&
+		(f.Repository == "" || e.Event.Repository == f.Repository) &&
+		strings.HasPrefix(e.Event.Tag, f.TagPrefix) &&
+		(f.EventID == "" || e.Event.ID == f.EventID)
+}
+
+// Read returns the entries of r that match filter, in journal order.
+func Read(r io.Reader, filter Filter) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, fmt.Errorf("line %d: %w", line, err)
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// ReadFiles reads the matching entries of files in order.
+func ReadFiles(files []string, filter Filter) ([]Entry, error) {
+	var entries []Entry
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return entries, err
+		}
+		read, err := Read(file, filter)
+		file.Close()
+		entries = append(entries, read...)
+		if err != nil {
+			return entries, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return entries, nil
+}
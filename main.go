@@ -1,19 +1,51 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"ljos.app/ecr-change-receiver/web"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "genkey":
+			os.Exit(genkey(os.Args[2:]))
+		}
+	}
 	secretName := os.Getenv("AWS_ECR_WEBHOOK_SECRET_NAME")
 	accessKey := os.Getenv("AWS_ECR_WEBHOOK_ACCESS_KEY")
 	accessSecret := os.Getenv("AWS_ECR_WEBHOOK_ACCESS_SECRET")
 	region := os.Getenv("AWS_ECR_WEBHOOK_REGION")
 	webServer := web.NewWeb(accessKey, accessSecret, region, secretName)
-	defer webServer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
 	slog.Info("Starting web server")
-	webServer.Start()
+	go func() {
+		errs <- webServer.Start()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-errs:
+		if err != nil {
+			slog.Error("Web server failed", "error", err)
+			exitCode = 1
+		}
+	case <-ctx.Done():
+		slog.Info("Received shutdown signal")
+	}
+	stop()
+	if err := webServer.Shutdown(); err != nil {
+		exitCode = 1
+	}
+	os.Exit(exitCode)
 }
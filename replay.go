@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"ljos.app/ecr-change-receiver/journal"
+	"ljos.app/ecr-change-receiver/web"
+)
+
+// replay implements the replay command, which runs journaled events, or a
+// filtered slice of them, through the deployment pipeline again.
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	path := flags.String("journal", "", "journal file; its rotated files are read first")
+	since := flags.String("since", "", "only entries received at or after this RFC 3339 time")
+	until := flags.String("until", "", "only entries received before this RFC 3339 time")
+	var filter journal.Filter
+	flags.StringVar(&filter.Source, "source", "", "only entries from this source, such as update, sns or sqs")
+	flags.StringVar(&filter.Outcome, "outcome", "", "only entries with this outcome, such as queued")
+	flags.StringVar(&filter.Repository, "repository", "", "only events for this repository")
+	flags.StringVar(&filter.TagPrefix, "tag-prefix", "", "only events for tags with this prefix")
+	flags.StringVar(&filter.EventID, "event-id", "", "only the event with this id")
+	dryRun := flags.Bool("dry-run", false, "print the matching entries instead of replaying them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "replay: -journal is required")
+		return 2
+	}
+	for _, t := range []struct {
+		value string
+		into  *time.Time
+	}{{*since, &filter.Since}, {*until, &filter.Until}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+			return 2
+		}
+		*t.into = parsed
+	}
+
+	files, err := journal.Files(*path)
+	if err != nil {
+		slog.Error("Failed to list journal files", "error", err)
+		return 1
+	}
+	entries, err := journal.ReadFiles(files, filter)
+	if err != nil {
+		slog.Error("Failed to read journal", "error", err)
+		return 1
+	}
+	slog.Info("Read journal", "files", len(files), "entries", len(entries))
+	if *dryRun {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, entry := range entries {
+			encoder.Encode(entry)
+		}
+		return 0
+	}
+
+	webServer := web.NewWeb(os.Getenv("AWS_ECR_WEBHOOK_ACCESS_KEY"), os.Getenv("AWS_ECR_WEBHOOK_ACCESS_SECRET"),
+		os.Getenv("AWS_ECR_WEBHOOK_REGION"), os.Getenv("AWS_ECR_WEBHOOK_SECRET_NAME"))
+	if err := webServer.Replay(entries, os.Stdout); err != nil {
+		slog.Error("Replay failed", "error", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Staging labels Secrets Manager uses for the versions of a secret.
+const (
+	stageCurrent  = "AWSCURRENT"
+	stagePending  = "AWSPENDING"
+	stagePrevious = "AWSPREVIOUS"
+)
+
+// secretsManagerClient is the part of the Secrets Manager API used for
+// loading and rotating the secret.
+type secretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+	UpdateSecretVersionStage(ctx context.Context, params *secretsmanager.UpdateSecretVersionStageInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error)
+}
+
+// awsBackend stores the secret in AWS Secrets Manager.
+type awsBackend struct {
+	client     secretsManagerClient
+	secretName string
+}
+
+func (b *awsBackend) Current(ctx context.Context) (Version, error) {
+	version, _, err := b.get(ctx, stageCurrent)
+	return version, err
+}
+
+func (b *awsBackend) Previous(ctx context.Context) (Version, bool, error) {
+	return b.get(ctx, stagePrevious)
+}
+
+func (b *awsBackend) get(ctx context.Context, stage string) (Version, bool, error) {
+	result, err := b.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(b.secretName),
+		VersionStage: aws.String(stage),
+	})
+	var notFound *types.ResourceNotFoundException
+	if stage != stageCurrent && errors.As(err, &notFound) {
+		return Version{}, false, nil
+	}
+	if err != nil {
+		return Version{}, false, err
+	}
+	return Version{
+		ID:      aws.ToString(result.VersionId),
+		Created: aws.ToTime(result.CreatedDate),
+		Value:   aws.ToString(result.SecretString),
+	}, true, nil
+}
+
+// RotationPending reports whether an AWSPENDING version other than current
+// was left behind, for example by a replica that stopped mid-rotation.
+func (b *awsBackend) RotationPending(ctx context.Context, current Version) (bool, error) {
+	pending, found, err := b.get(ctx, stagePending)
+	if err != nil || !found {
+		return false, err
+	}
+	return pending.ID != current.ID, nil
+}
+
+// Rotate stores value as AWSPENDING and then moves AWSCURRENT to it, which
+// makes Secrets Manager label the replaced version AWSPREVIOUS. The version
+// id is derived from the current version, so replicas rotating at the same
+// time all target the same version and only one key is stored. A rotation
+// that was interrupted is finished by the next one.
+func (b *awsBackend) Rotate(ctx context.Context, current Version, value string) error {
+	token := rotationToken(current.ID)
+	log := slog.With("secretName", b.secretName, "from", current.ID, "to", token)
+
+	_, err := b.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(b.secretName),
+		ClientRequestToken: aws.String(token),
+		SecretString:       aws.String(value),
+		VersionStages:      []string{stagePending},
+	})
+	var exists *types.ResourceExistsException
+	if errors.As(err, &exists) {
+		log.Info("Pending webhook key was already created by another replica")
+	} else if err != nil {
+		return err
+	}
+
+	_, err = b.client.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(b.secretName),
+		VersionStage:        aws.String(stageCurrent),
+		MoveToVersionId:     aws.String(token),
+		RemoveFromVersionId: aws.String(current.ID),
+	})
+	if err != nil {
+		after, currentErr := b.Current(ctx)
+		if currentErr != nil || after.ID != token {
+			return err
+		}
+		log.Info("Webhook key was already promoted by another replica")
+	} else {
+		log.Info("Rotated webhook key")
+	}
+
+	_, err = b.client.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(b.secretName),
+		VersionStage:        aws.String(stagePending),
+		RemoveFromVersionId: aws.String(token),
+	})
+	if err != nil {
+		log.Warn("Failed to remove pending label from webhook key", "error", err)
+	}
+	return nil
+}
+
+// rotationToken is the version id of the key replacing version current.
+func rotationToken(current string) string {
+	sum := sha256.Sum256([]byte("rotation:" + current))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	awsclient "ljos.app/ecr-change-receiver/aws"
+)
+
+// Version is one version of the secret JSON holding the webhook keys.
+type Version struct {
+	// ID changes whenever Value does.
+	ID      string
+	Created time.Time
+	Value   string
+}
+
+// Backend reads the secret from where it is stored.
+type Backend interface {
+	Current(ctx context.Context) (Version, error)
+}
+
+// PreviousBackend is a Backend that keeps the version replaced last, whose
+// keys stay valid for the grace period after a restart.
+type PreviousBackend interface {
+	Backend
+	// Previous returns false when there is no previous version.
+	Previous(ctx context.Context) (Version, bool, error)
+}
+
+// RotatingBackend is a Backend that can replace the current version. Rotate
+// must leave a single new version when replicas rotate the same version at
+// the same time.
+type RotatingBackend interface {
+	Backend
+	Rotate(ctx context.Context, current Version, value string) error
+	// RotationPending reports whether a rotation of current was started but
+	// not finished, so it is finished before it is due.
+	RotationPending(ctx context.Context, current Version) (bool, error)
+}
+
+// newBackend creates the configured backend. secretName is the name of the
+// secret in Secrets Manager and the default name in SSM and Vault.
+func newBackend(config Config, region, secretName string) (Backend, error) {
+	switch config.Backend {
+	case BackendSecretsManager:
+		return &awsBackend{client: awsclient.CreateSecretsManagerClient(region), secretName: secretName}, nil
+	case BackendSsm:
+		name := config.Ssm.Parameter
+		if name == "" {
+			name = secretName
+		}
+		return &ssmBackend{client: awsclient.CreateSsmClient(region), name: name}, nil
+	case BackendFile:
+		return &fileBackend{path: config.File.Path}, nil
+	case BackendEnv:
+		return &envBackend{variable: config.Env.Variable}, nil
+	case BackendVault:
+		if config.Vault.Path == "" {
+			config.Vault.Path = secretName
+		}
+		return newVaultBackend(config.Vault)
+	}
+	return nil, fmt.Errorf("unknown secret backend %q", config.Backend)
+}
+
+// localVersion makes a version of a secret read from a file, the
+// environment or SSM, which may hold the secret JSON or a bare webhook key.
+func localVersion(content string, modified time.Time) (Version, error) {
+	value := strings.TrimSpace(content)
+	if value == "" {
+		return Version{}, fmt.Errorf("secret is empty")
+	}
+	if !strings.HasPrefix(value, "{") {
+		var err error
+		if value, err = withKey("", value); err != nil {
+			return Version{}, err
+		}
+	}
+	sum := sha256.Sum256([]byte(value))
+	return Version{ID: hex.EncodeToString(sum[:8]), Created: modified, Value: value}, nil
+}
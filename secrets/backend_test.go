@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestFileBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ecr-webhook-secret")
+	if err := os.WriteFile(path, []byte("bare-key\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	ss := &SecretService{secretName: "file", backend: &fileBackend{path: path}, config: Config{GracePeriod: time.Hour}}
+	ss.refresh()
+	if err := ss.Health(); err != nil || !ss.Validate("bare-key") {
+		t.Fatalf("Expected a bare key to be loaded, got %v", err)
+	}
+
+	err := os.WriteFile(path, []byte(`{"ecr-webhook-secret":"new-key","clients":{"ci":{"key":"ci-key"}}}`), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	ss.refresh()
+	if !ss.Validate("new-key") || !ss.Validate("ci-key") || !ss.Validate("bare-key") {
+		t.Fatalf("Expected the replaced file to load with the old key in its grace period")
+	}
+
+	os.Remove(path)
+	ss.refresh()
+	if err := ss.Health(); err == nil || !ss.Validate("new-key") {
+		t.Errorf("Expected a missing file to fail the refresh and keep the key, got %v", err)
+	}
+}
+
+func TestEnvBackend(t *testing.T) {
+	t.Setenv("TEST_WEBHOOK_SECRET", "env-key")
+	ss := &SecretService{secretName: "env", backend: &envBackend{variable: "TEST_WEBHOOK_SECRET"}, config: Config{RotationInterval: time.Hour}}
+	if err := ss.check(context.Background()); err != nil || !ss.Validate("env-key") {
+		t.Fatalf("Expected the key of the environment variable, got %v", err)
+	}
+	if _, err := (&envBackend{variable: "TEST_WEBHOOK_SECRET_UNSET"}).Current(context.Background()); err == nil {
+		t.Errorf("Expected an unset variable to fail")
+	}
+}
+
+// fakeSsm holds the versions of one parameter.
+type fakeSsm struct {
+	name   string
+	values []string
+}
+
+func (f *fakeSsm) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	version := len(f.values)
+	name := aws.ToString(params.Name)
+	if name != f.name {
+		if _, err := fmt.Sscanf(name, f.name+":%d", &version); err != nil {
+			return nil, &types.ParameterNotFound{}
+		}
+	}
+	if version < 1 || version > len(f.values) {
+		return nil, &types.ParameterVersionNotFound{}
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{
+		Name:             aws.String(f.name),
+		Value:            aws.String(f.values[version-1]),
+		Version:          int64(version),
+		LastModifiedDate: aws.Time(time.Now()),
+	}}, nil
+}
+
+func TestSsmBackend(t *testing.T) {
+	client := &fakeSsm{name: "webhook", values: []string{"bare-key"}}
+	backend := &ssmBackend{client: client, name: "webhook"}
+	current, err := backend.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read parameter: %v", err)
+	}
+	if key, _, err := parseSecret(current.Value); err != nil || key != "bare-key" || current.ID != "1" {
+		t.Fatalf("Expected a bare key to be read as version 1, got %+v %v", current, err)
+	}
+	if _, found, err := backend.Previous(context.Background()); found || err != nil {
+		t.Errorf("Expected no previous version of the first one, got %v %v", found, err)
+	}
+
+	client.values = append(client.values, `{"ecr-webhook-secret":"new-key"}`)
+	ss := &SecretService{secretName: "webhook", backend: backend, config: Config{GracePeriod: time.Hour}}
+	if err := ss.check(context.Background()); err != nil {
+		t.Fatalf("Failed to load parameter: %v", err)
+	}
+	if !ss.Validate("new-key") || !ss.Validate("bare-key") {
+		t.Errorf("Expected the current key and the previous version's key in its grace period")
+	}
+
+	client.values = append(client.values, "  ")
+	if _, err := backend.Current(context.Background()); err == nil {
+		t.Errorf("Expected an empty parameter to fail")
+	}
+}
+
+// fakeVault serves one KV version 2 secret.
+type fakeVault struct {
+	mutex    sync.Mutex
+	versions []map[string]any
+	created  []time.Time
+}
+
+func (f *fakeVault) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if r.Header.Get("X-Vault-Token") != "token" {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/v1/secret/data/webhook" {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPost {
+		var write struct {
+			Options struct {
+				Cas int `json:"cas"`
+			} `json:"options"`
+			Data map[string]any `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&write)
+		if write.Options.Cas != len(f.versions) {
+			rw.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(rw).Encode(map[string][]string{"errors": {"check-and-set parameter did not match the current version"}})
+			return
+		}
+		f.versions = append(f.versions, write.Data)
+		f.created = append(f.created, time.Now())
+		return
+	}
+	version := len(f.versions)
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, _ = strconv.Atoi(v)
+	}
+	if version < 1 || version > len(f.versions) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(rw).Encode(map[string]any{"data": map[string]any{
+		"data":     f.versions[version-1],
+		"metadata": map[string]any{"version": version, "created_time": f.created[version-1]},
+	}})
+}
+
+func TestVaultBackend(t *testing.T) {
+	vault := &fakeVault{
+		versions: []map[string]any{{"ecr-webhook-secret": "first"}, {"ecr-webhook-secret": "second"}},
+		created:  []time.Time{time.Now().Add(-72 * time.Hour), time.Now().Add(-48 * time.Hour)},
+	}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	t.Setenv("TEST_VAULT_TOKEN", "token")
+	backend, err := newVaultBackend(VaultConfig{Address: server.URL, Mount: "secret", Path: "webhook", TokenEnv: "TEST_VAULT_TOKEN"})
+	if err != nil {
+		t.Fatalf("Failed to create vault backend: %v", err)
+	}
+	config := Config{RotationInterval: 24 * time.Hour, GracePeriod: time.Hour}
+	a := &SecretService{secretName: "vault", backend: backend, config: config}
+	b := &SecretService{secretName: "vault", backend: backend, config: config}
+
+	var wg sync.WaitGroup
+	for _, ss := range []*SecretService{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ss.check(context.Background()); err != nil {
+				t.Errorf("Failed to check rotation: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(vault.versions) != 3 {
+		t.Fatalf("Expected one rotation across replicas, got %d versions", len(vault.versions))
+	}
+	if a.secrets.version != "3" || b.secrets.version != "3" || a.secrets.currentKey != b.secrets.currentKey {
+		t.Fatalf("Expected both replicas to load version 3, got %q and %q", a.secrets.version, b.secrets.version)
+	}
+	if !a.Validate("second") || a.Validate("first") {
+		t.Errorf("Expected the previous key to be valid and older keys not")
+	}
+}
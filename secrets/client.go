@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultClient is the name of the client authenticated with the
+// ecr-webhook-secret key, which may deploy every watched image.
+const DefaultClient = "webhook"
+
+// secretClientsField is the field of the secret JSON holding named clients.
+const secretClientsField = "clients"
+
+// Client is a caller of the webhook endpoints with its own key.
+type Client struct {
+	Name string
+	// Repositories and TagPrefixes limit which images the client may
+	// deploy. An empty list allows all.
+	Repositories []string
+	TagPrefixes  []string
+	key          string
+}
+
+// ClientConfig defines a client whose key is read from an environment
+// variable.
+type ClientConfig struct {
+	Name         string   `yaml:"name"`
+	KeyEnv       string   `yaml:"keyEnv"`
+	Repositories []string `yaml:"repositories"`
+	TagPrefixes  []string `yaml:"tagPrefixes"`
+}
+
+// secretClient is a client as stored in the secret JSON under its name.
+type secretClient struct {
+	Key          string   `json:"key"`
+	Repositories []string `json:"repositories"`
+	TagPrefixes  []string `json:"tagPrefixes"`
+}
+
+// Allows reports whether the client may deploy tag of repository. Leading
+// slashes of repository names are ignored, as the admin endpoints add one.
+func (c Client) Allows(repository, tag string) bool {
+	if len(c.Repositories) > 0 {
+		allowed := false
+		for _, r := range c.Repositories {
+			if strings.TrimPrefix(r, "/") == strings.TrimPrefix(repository, "/") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if len(c.TagPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.TagPrefixes {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// configClients reads the keys of clients from their environment variables.
+func configClients(configs []ClientConfig) ([]Client, error) {
+	clients := make([]Client, 0, len(configs))
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("client without name")
+		}
+		key := os.Getenv(c.KeyEnv)
+		if c.KeyEnv == "" || key == "" {
+			return nil, fmt.Errorf("client %s: no key in environment variable %q", c.Name, c.KeyEnv)
+		}
+		clients = append(clients, Client{Name: c.Name, Repositories: c.Repositories, TagPrefixes: c.TagPrefixes, key: key})
+	}
+	return clients, nil
+}
+
+// parseSecret returns the webhook key and the named clients of a secret.
+// Either may be missing, but not both.
+func parseSecret(secretString string) (string, []Client, error) {
+	var secret map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(secretString), &secret); err != nil {
+		return "", nil, err
+	}
+	var key string
+	if raw, ok := secret[secretKeyField]; ok {
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", secretKeyField, err)
+		}
+	}
+	var named map[string]secretClient
+	if raw, ok := secret[secretClientsField]; ok {
+		if err := json.Unmarshal(raw, &named); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", secretClientsField, err)
+		}
+	}
+	clients := make([]Client, 0, len(named))
+	for name, c := range named {
+		if c.Key == "" {
+			return "", nil, fmt.Errorf("%s: client %s has no key", secretClientsField, name)
+		}
+		clients = append(clients, Client{Name: name, Repositories: c.Repositories, TagPrefixes: c.TagPrefixes, key: c.Key})
+	}
+	if key == "" && len(clients) == 0 {
+		return "", nil, fmt.Errorf("no %s or %s", secretKeyField, secretClientsField)
+	}
+	return key, clients, nil
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientAllows(t *testing.T) {
+	staging := Client{Name: "staging", Repositories: []string{"my-repo", "/tools/hello-world"}, TagPrefixes: []string{"staging-"}}
+	tests := []struct {
+		client     Client
+		repository string
+		tag        string
+		allowed    bool
+	}{
+		{staging, "my-repo", "staging-1.2.0", true},
+		{staging, "/my-repo", "staging-1.2.0", true},
+		{staging, "tools/hello-world", "staging-1", true},
+		{staging, "my-repo", "v1.2.0", false},
+		{staging, "my-repo-2", "staging-1.2.0", false},
+		{Client{Name: DefaultClient}, "anything", "v1", true},
+		{Client{Name: "tags", TagPrefixes: []string{"v"}}, "anything", "v1", true},
+	}
+	for _, test := range tests {
+		if got := test.client.Allows(test.repository, test.tag); got != test.allowed {
+			t.Errorf("%s: Allows(%q, %q) = %v, expected %v", test.client.Name, test.repository, test.tag, got, test.allowed)
+		}
+	}
+}
+
+func TestAuthenticateNamedClients(t *testing.T) {
+	key, clients, err := parseSecret(`{"ecr-webhook-secret":"shared","clients":{"staging":{"key":"staging-key","repositories":["my-repo"],"tagPrefixes":["staging-"]}}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse secret: %v", err)
+	}
+	ss := &SecretService{configClients: []Client{{Name: "ci", key: "ci-key"}}}
+	ss.secrets = Secrets{currentKey: key, currentClients: clients}
+
+	for secret, name := range map[string]string{"shared": DefaultClient, "staging-key": "staging", "ci-key": "ci"} {
+		client, ok := ss.Authenticate(secret)
+		if !ok || client.Name != name {
+			t.Errorf("Expected %q to authenticate %s, got %q %v", secret, name, client.Name, ok)
+		}
+	}
+	if client, _ := ss.Authenticate("staging-key"); client.Allows("my-repo", "v1.0.0") {
+		t.Errorf("Expected the staging client not to deploy production tags")
+	}
+
+	// a client removed from the secret keeps working within the grace period
+	ss.secrets = Secrets{currentKey: key, prevClients: clients, prevKeyExpirey: time.Now().Add(time.Minute)}
+	if _, ok := ss.Authenticate("staging-key"); !ok {
+		t.Errorf("Expected the previous client key to be valid within the grace period")
+	}
+	ss.secrets.prevKeyExpirey = time.Now().Add(-time.Minute)
+	if _, ok := ss.Authenticate("staging-key"); ok {
+		t.Errorf("Expected the previous client key to be rejected after the grace period")
+	}
+
+	if _, _, err := parseSecret(`{"clients":{"prod":{}}}`); err == nil {
+		t.Errorf("Expected a client without key to be rejected")
+	}
+	if _, _, err := parseSecret(`{}`); err == nil {
+		t.Errorf("Expected a secret without keys to be rejected")
+	}
+}
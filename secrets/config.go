@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Backends the secret can be read from.
+const (
+	BackendSecretsManager = "secretsmanager"
+	BackendSsm            = "ssm"
+	BackendFile           = "file"
+	BackendEnv            = "env"
+	BackendVault          = "vault"
+)
+
+type SsmConfig struct {
+	// Parameter is the name of the SecureString parameter, by default the
+	// secret name.
+	Parameter string `yaml:"parameter"`
+}
+
+type FileConfig struct {
+	// Path is the file holding the secret JSON or a bare webhook key.
+	Path string `yaml:"path"`
+}
+
+type EnvConfig struct {
+	// Variable is the environment variable holding the secret JSON or a bare
+	// webhook key.
+	Variable string `yaml:"variable"`
+}
+
+type VaultConfig struct {
+	// Address is the Vault server URL, by default $VAULT_ADDR.
+	Address string `yaml:"address"`
+	// Mount is the path the KV version 2 engine is mounted at.
+	Mount string `yaml:"mount"`
+	// Path is the path of the secret within the mount, by default the
+	// secret name.
+	Path string `yaml:"path"`
+	// TokenEnv is the environment variable holding the Vault token.
+	TokenEnv string `yaml:"tokenEnv"`
+	// Namespace is sent as X-Vault-Namespace when set.
+	Namespace string `yaml:"namespace"`
+}
+
+type Config struct {
+	// Backend is where the secret is stored: "secretsmanager" (default),
+	// "ssm", "file", "env" or "vault". Only Secrets Manager and Vault can
+	// rotate the key.
+	Backend string      `yaml:"backend"`
+	Ssm     SsmConfig   `yaml:"ssm"`
+	File    FileConfig  `yaml:"file"`
+	Env     EnvConfig   `yaml:"env"`
+	Vault   VaultConfig `yaml:"vault"`
+	// RefreshInterval is how often the backend is checked for a new
+	// version of the secret, whether rotated by a replica or by hand.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	// RotationInterval is how old the current key may get before it is
+	// replaced. Rotation is disabled when it is zero.
+	RotationInterval time.Duration `yaml:"rotationInterval"`
+	// GracePeriod is how long the previous key is still accepted after a
+	// rotation, so callers that cached it can refresh.
+	GracePeriod time.Duration `yaml:"gracePeriod"`
+	// Clients are named clients besides those stored in the secret.
+	Clients []ClientConfig `yaml:"clients"`
+	// HashedKeys requires every key to be stored as a hash made by the
+	// genkey command, so the receiver never holds a usable key. Hashed keys
+	// are not rotated and cannot check hmac signatures.
+	HashedKeys bool `yaml:"hashedKeys"`
+	// PepperEnv is the environment variable holding the server secret keys
+	// are hashed with.
+	PepperEnv string `yaml:"pepperEnv"`
+}
+
+type fileConfig struct {
+	Secrets Config `yaml:"secrets"`
+}
+
+func (c *Config) setDefaults() {
+	if c.Backend == "" {
+		c.Backend = BackendSecretsManager
+	}
+	if c.File.Path == "" {
+		c.File.Path = "/run/secrets/ecr-webhook-secret"
+	}
+	if c.Env.Variable == "" {
+		c.Env.Variable = "ECR_WEBHOOK_SECRET"
+	}
+	if c.Vault.Address == "" {
+		c.Vault.Address = os.Getenv("VAULT_ADDR")
+	}
+	if c.Vault.Mount == "" {
+		c.Vault.Mount = "secret"
+	}
+	if c.Vault.TokenEnv == "" {
+		c.Vault.TokenEnv = "VAULT_TOKEN"
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = time.Minute
+	}
+	if c.PepperEnv == "" {
+		c.PepperEnv = "ECR_WEBHOOK_PEPPER"
+	}
+	if c.GracePeriod <= 0 {
+		c.GracePeriod = 15 * time.Minute
+	}
+}
+
+func newConfig() *Config {
+	c := &fileConfig{}
+	data, err := os.ReadFile("./conf/conf.yml")
+	if err != nil {
+		panic(err)
+	}
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		panic(err)
+	}
+	c.Secrets.setDefaults()
+	return &c.Secrets
+}
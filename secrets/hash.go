@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// hashPrefix marks a stored key as "$hmac-sha256$<salt>$<digest>", where
+// digest is HMAC-SHA256(pepper, salt + key) and both are base64 encoded.
+const hashPrefix = "$hmac-sha256$"
+
+const saltSize = 16
+
+var errNoPepper = errors.New("hashing keys needs a pepper")
+
+// NewKey generates a webhook key and its hash under pepper. The key is for
+// the caller and the hash for the secret.
+func NewKey(pepper []byte) (key, hash string, err error) {
+	key = generateKey()
+	hash, err = HashKey(key, pepper)
+	return key, hash, err
+}
+
+// HashKey returns the stored form of key with a random salt.
+func HashKey(key string, pepper []byte) (string, error) {
+	if len(pepper) == 0 {
+		return "", errNoPepper
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPrefix + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(keyDigest(pepper, salt, key)), nil
+}
+
+func keyDigest(pepper, salt []byte, key string) []byte {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write(salt)
+	mac.Write([]byte(key))
+	return mac.Sum(nil)
+}
+
+func isHashedKey(stored string) bool {
+	return strings.HasPrefix(stored, hashPrefix)
+}
+
+// hashMatches reports whether secret is the key stored as hash.
+func hashMatches(secret, hash string, pepper []byte) bool {
+	if len(pepper) == 0 {
+		return false
+	}
+	encodedSalt, encodedDigest, ok := strings.Cut(strings.TrimPrefix(hash, hashPrefix), "$")
+	if !ok {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+	digest, err := base64.RawStdEncoding.DecodeString(encodedDigest)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(digest, keyDigest(pepper, salt, secret))
+}
+
+// requireHashed returns an error naming the first of key and clients that is
+// stored in plaintext. source tells where the plaintext key was found.
+func requireHashed(source, key string, clients []Client) error {
+	if key != "" && !isHashedKey(key) {
+		return fmt.Errorf("%s holds a plaintext key, but keys must be hashed", source)
+	}
+	for _, c := range clients {
+		if !isHashedKey(c.key) {
+			return fmt.Errorf("client %s has a plaintext key, but keys must be hashed", c.Name)
+		}
+	}
+	return nil
+}
+
+// keyMatches reports whether secret is the key stored as key, which is
+// either the key itself or its hash.
+func (ss *SecretService) keyMatches(secret, key string) bool {
+	switch {
+	case key == "":
+		return false
+	case isHashedKey(key):
+		return hashMatches(secret, key, ss.pepper)
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(key)) == 1
+}
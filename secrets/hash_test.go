@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashedKeys(t *testing.T) {
+	pepper := []byte("pepper")
+	key, hash, err := NewKey(pepper)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if strings.Contains(hash, key) || !isHashedKey(hash) {
+		t.Fatalf("Expected a hash that does not contain the key, got %s", hash)
+	}
+	if other, _ := HashKey(key, pepper); other == hash {
+		t.Errorf("Expected hashes of the same key to be salted differently")
+	}
+	if !hashMatches(key, hash, pepper) || hashMatches(key, hash, []byte("other")) || hashMatches("other", hash, pepper) {
+		t.Errorf("Expected the hash to match only the key under the same pepper")
+	}
+	if _, err := HashKey(key, nil); err == nil {
+		t.Errorf("Expected hashing without pepper to fail")
+	}
+
+	_, clientHash, _ := NewKey(pepper)
+	t.Setenv("TEST_WEBHOOK_SECRET", `{"ecr-webhook-secret":"`+hash+`","clients":{"ci":{"key":"`+clientHash+`"}}}`)
+	ss := &SecretService{
+		secretName: "env",
+		backend:    &envBackend{variable: "TEST_WEBHOOK_SECRET"},
+		config:     Config{HashedKeys: true, RotationInterval: time.Hour},
+		pepper:     pepper,
+	}
+	if err := ss.check(context.Background()); err != nil {
+		t.Fatalf("Failed to load hashed keys: %v", err)
+	}
+	if client, ok := ss.Authenticate(key); !ok || client.Name != DefaultClient {
+		t.Errorf("Expected the key to authenticate against its hash")
+	}
+	if ss.Validate(hash) {
+		t.Errorf("Expected the hash itself not to be a usable key")
+	}
+	if ss.ValidateSignature([]byte("message"), []byte("signature")) {
+		t.Errorf("Expected signatures not to match hashed keys")
+	}
+
+	t.Setenv("TEST_WEBHOOK_SECRET", `{"ecr-webhook-secret":"`+hash+`","clients":{"ci":{"key":"plaintext"}}}`)
+	if err := ss.check(context.Background()); err == nil {
+		t.Errorf("Expected a plaintext client key to be refused")
+	}
+	if !ss.Validate(key) {
+		t.Errorf("Expected the last good keys to stay loaded")
+	}
+}
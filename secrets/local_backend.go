@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileBackend reads the secret from a file, such as a Docker or Kubernetes
+// secret mounted under /run/secrets. The file is read again on every
+// refresh, so replacing it changes the keys.
+type fileBackend struct {
+	path string
+}
+
+func (b *fileBackend) Current(ctx context.Context) (Version, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return Version{}, err
+	}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return Version{}, err
+	}
+	version, err := localVersion(string(data), info.ModTime())
+	if err != nil {
+		return Version{}, fmt.Errorf("%s: %w", b.path, err)
+	}
+	return version, nil
+}
+
+// envBackend reads the secret from an environment variable, which cannot
+// change while the receiver runs.
+type envBackend struct {
+	variable string
+}
+
+func (b *envBackend) Current(ctx context.Context) (Version, error) {
+	version, err := localVersion(os.Getenv(b.variable), time.Time{})
+	if err != nil {
+		return Version{}, fmt.Errorf("environment variable %s: %w", b.variable, err)
+	}
+	return version, nil
+}
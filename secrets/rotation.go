@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// secretKeyField is the field of the secret JSON holding the webhook key.
+const secretKeyField = "ecr-webhook-secret"
+
+const requestTimeout = 30 * time.Second
+
+// check rotates the key when it is due or an earlier rotation was left
+// unfinished, and loads the keys when the current version changed.
+func (ss *SecretService) check(ctx context.Context) error {
+	current, err := ss.backend.Current(ctx)
+	if err != nil {
+		return err
+	}
+	rotator, ok := ss.backend.(RotatingBackend)
+	if ok {
+		ok, err = ss.rotationDue(ctx, rotator, current)
+		if err != nil {
+			return err
+		}
+	}
+	if ok {
+		if err := ss.rotate(ctx, rotator, current); err != nil {
+			// another replica may have rotated at the same time, so the
+			// current version is read again either way
+			slog.Error("Failed to rotate webhook key", "secretName", ss.secretName, "error", err)
+		}
+		if current, err = ss.backend.Current(ctx); err != nil {
+			return err
+		}
+	}
+	ss.mutex.Lock()
+	loaded := ss.secrets.version
+	ss.mutex.Unlock()
+	if current.ID == loaded {
+		return nil
+	}
+	return ss.load(ctx, current)
+}
+
+// rotationDue reports whether current is older than the rotation interval
+// or an earlier rotation of it was left unfinished.
+func (ss *SecretService) rotationDue(ctx context.Context, rotator RotatingBackend, current Version) (bool, error) {
+	if ss.config.RotationInterval <= 0 || ss.config.HashedKeys {
+		return false, nil
+	}
+	if time.Since(current.Created) >= ss.config.RotationInterval {
+		return true, nil
+	}
+	return rotator.RotationPending(ctx, current)
+}
+
+// rotate replaces the shared webhook key of current. Named clients keep
+// their keys.
+func (ss *SecretService) rotate(ctx context.Context, rotator RotatingBackend, current Version) error {
+	key, _, err := parseSecret(current.Value)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		slog.Debug("Secret has no shared webhook key to rotate", "secretName", ss.secretName)
+		return nil
+	}
+	value, err := withKey(current.Value, generateKey())
+	if err != nil {
+		return err
+	}
+	return rotator.Rotate(ctx, current, value)
+}
+
+// load reads the keys of current. When they replace loaded keys, the
+// replaced keys stay valid for GracePeriod from now. At startup the keys of
+// the previous version are accepted until GracePeriod after the current
+// version was created, so a restarted replica agrees with the others.
+func (ss *SecretService) load(ctx context.Context, current Version) error {
+	currentKey, currentClients, err := ss.parseSecret(current)
+	if err != nil {
+		return err
+	}
+	ss.mutex.Lock()
+	loaded := ss.secrets
+	ss.mutex.Unlock()
+	next := Secrets{currentKey: currentKey, currentClients: currentClients, version: current.ID}
+	if loaded.version != "" {
+		next.prevKey, next.prevClients = loaded.currentKey, loaded.currentClients
+		next.prevKeyExpirey = time.Now().Add(ss.config.GracePeriod)
+	} else if previous, ok := ss.backend.(PreviousBackend); ok {
+		version, found, err := previous.Previous(ctx)
+		if err != nil {
+			return err
+		}
+		if found {
+			// the previous keys are only a courtesy to callers, so a version
+			// from before keys were hashed does not stop the current one
+			if next.prevKey, next.prevClients, err = ss.parseSecret(version); err != nil {
+				slog.Warn("Ignoring previous webhook key", "secretName", ss.secretName, "error", err)
+			}
+			next.prevKeyExpirey = current.Created.Add(ss.config.GracePeriod)
+		}
+	}
+	ss.mutex.Lock()
+	ss.secrets = next
+	ss.mutex.Unlock()
+	slog.Info("Loaded webhook key", "secretName", ss.secretName, "version", current.ID, "previousVersion", loaded.version, "clients", len(currentClients))
+	return nil
+}
+
+// parseSecret returns the keys of version, which must all be hashed when
+// HashedKeys is set.
+func (ss *SecretService) parseSecret(version Version) (string, []Client, error) {
+	key, clients, err := parseSecret(version.Value)
+	if err == nil && ss.config.HashedKeys {
+		err = requireHashed(secretKeyField, key, clients)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("version %s: %w", version.ID, err)
+	}
+	return key, clients, nil
+}
+
+// withKey replaces the webhook key in secretString, keeping any other
+// fields of the secret.
+func withKey(secretString, key string) (string, error) {
+	secret := map[string]json.RawMessage{}
+	if secretString != "" {
+		if err := json.Unmarshal([]byte(secretString), &secret); err != nil {
+			return "", err
+		}
+	}
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	secret[secretKeyField] = raw
+	data, err := json.Marshal(secret)
+	return string(data), err
+}
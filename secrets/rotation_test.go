@@ -0,0 +1,233 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+type fakeVersion struct {
+	value   string
+	stages  []string
+	created time.Time
+}
+
+// fakeSecretsManager keeps the versions of one secret and moves staging
+// labels the way Secrets Manager does.
+type fakeSecretsManager struct {
+	mutex    sync.Mutex
+	versions map[string]*fakeVersion
+	// getErr is returned by GetSecretValue when set
+	getErr error
+}
+
+func newFakeSecretsManager(key string, created time.Time) *fakeSecretsManager {
+	return &fakeSecretsManager{versions: map[string]*fakeVersion{
+		"v1": {value: `{"ecr-webhook-secret":"` + key + `","other":"kept"}`, stages: []string{stageCurrent}, created: created},
+	}}
+}
+
+func (f *fakeSecretsManager) staged(stage string) string {
+	for id, v := range f.versions {
+		if slices.Contains(v.stages, stage) {
+			return id
+		}
+	}
+	return ""
+}
+
+func (f *fakeSecretsManager) moveStage(stage, to string) {
+	for _, v := range f.versions {
+		v.stages = slices.DeleteFunc(v.stages, func(s string) bool { return s == stage })
+	}
+	if to != "" {
+		f.versions[to].stages = append(f.versions[to].stages, stage)
+	}
+}
+
+func (f *fakeSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	id := aws.ToString(params.VersionId)
+	if id == "" {
+		id = f.staged(aws.ToString(params.VersionStage))
+	}
+	v, ok := f.versions[id]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{}
+	}
+	return &secretsmanager.GetSecretValueOutput{VersionId: aws.String(id), CreatedDate: aws.Time(v.created), SecretString: aws.String(v.value)}, nil
+}
+
+func (f *fakeSecretsManager) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	id := aws.ToString(params.ClientRequestToken)
+	if v, ok := f.versions[id]; ok {
+		if v.value != aws.ToString(params.SecretString) {
+			return nil, &types.ResourceExistsException{}
+		}
+		return &secretsmanager.PutSecretValueOutput{VersionId: aws.String(id)}, nil
+	}
+	f.versions[id] = &fakeVersion{value: aws.ToString(params.SecretString), created: time.Now()}
+	for _, stage := range params.VersionStages {
+		f.moveStage(stage, id)
+	}
+	return &secretsmanager.PutSecretValueOutput{VersionId: aws.String(id)}, nil
+}
+
+func (f *fakeSecretsManager) UpdateSecretVersionStage(ctx context.Context, params *secretsmanager.UpdateSecretVersionStageInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	stage := aws.ToString(params.VersionStage)
+	attached := f.staged(stage)
+	if attached != "" && attached != aws.ToString(params.RemoveFromVersionId) {
+		return nil, &types.InvalidParameterException{Message: aws.String(fmt.Sprintf("%s is attached to %s", stage, attached))}
+	}
+	to := aws.ToString(params.MoveToVersionId)
+	f.moveStage(stage, to)
+	if stage == stageCurrent && attached != "" && to != "" {
+		f.moveStage(stagePrevious, attached)
+	}
+	return &secretsmanager.UpdateSecretVersionStageOutput{}, nil
+}
+
+func TestRotationAcrossReplicas(t *testing.T) {
+	fake := newFakeSecretsManager("old", time.Now().Add(-48*time.Hour))
+	config := Config{RotationInterval: 24 * time.Hour, GracePeriod: time.Hour}
+	a := &SecretService{secretName: "webhook", backend: &awsBackend{client: fake, secretName: "webhook"}, config: config}
+	b := &SecretService{secretName: "webhook", backend: &awsBackend{client: fake, secretName: "webhook"}, config: config}
+
+	var wg sync.WaitGroup
+	for _, ss := range []*SecretService{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ss.check(context.Background()); err != nil {
+				t.Errorf("Failed to check rotation: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(fake.versions) != 2 {
+		t.Fatalf("Expected exactly one new version, got %d versions", len(fake.versions))
+	}
+	current := fake.staged(stageCurrent)
+	if current == "v1" || fake.staged(stagePrevious) != "v1" || fake.staged(stagePending) != "" {
+		t.Fatalf("Expected the new version current and v1 previous, got current %q previous %q pending %q",
+			current, fake.staged(stagePrevious), fake.staged(stagePending))
+	}
+	if a.secrets.currentKey != b.secrets.currentKey || a.secrets.currentKey == "old" {
+		t.Fatalf("Expected both replicas to load the same new key")
+	}
+	for _, ss := range []*SecretService{a, b} {
+		if !ss.Validate(ss.secrets.currentKey) || !ss.Validate("old") {
+			t.Fatalf("Expected the new and previous keys to be valid within the grace period")
+		}
+	}
+	if value := fake.versions[current].value; !strings.Contains(value, `"other":"kept"`) {
+		t.Errorf("Expected other secret fields to be kept, got %s", value)
+	}
+
+	// the new key is not due yet, so checking again changes nothing
+	if err := a.check(context.Background()); err != nil {
+		t.Fatalf("Failed to check rotation: %v", err)
+	}
+	if len(fake.versions) != 2 {
+		t.Errorf("Expected no rotation before the interval, got %d versions", len(fake.versions))
+	}
+}
+
+func TestRotationFinishesPendingVersion(t *testing.T) {
+	fake := newFakeSecretsManager("old", time.Now())
+	config := Config{RotationInterval: 24 * time.Hour, GracePeriod: time.Hour}
+	ss := &SecretService{secretName: "webhook", backend: &awsBackend{client: fake, secretName: "webhook"}, config: config}
+	// a replica stopped after storing the pending version
+	token := rotationToken("v1")
+	fake.versions[token] = &fakeVersion{value: `{"ecr-webhook-secret":"new"}`, stages: []string{stagePending}, created: time.Now()}
+
+	if err := ss.check(context.Background()); err != nil {
+		t.Fatalf("Failed to check rotation: %v", err)
+	}
+	if fake.staged(stageCurrent) != token || ss.secrets.currentKey != "new" {
+		t.Fatalf("Expected the pending version to be promoted, got %q", fake.staged(stageCurrent))
+	}
+}
+
+func TestLoadWithoutRotation(t *testing.T) {
+	fake := newFakeSecretsManager("old", time.Now().Add(-48*time.Hour))
+	ss := &SecretService{secretName: "webhook", backend: &awsBackend{client: fake, secretName: "webhook"}, config: Config{GracePeriod: time.Hour}}
+	if err := ss.check(context.Background()); err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	if len(fake.versions) != 1 || !ss.Validate("old") {
+		t.Fatalf("Expected the key to be loaded without rotating")
+	}
+
+	fake.versions["v1"].value = `{}`
+	ss.secrets.version = ""
+	if err := ss.check(context.Background()); err == nil {
+		t.Errorf("Expected a secret without key to fail")
+	}
+}
+
+func TestRefreshPicksUpExternalChange(t *testing.T) {
+	fake := newFakeSecretsManager("old", time.Now().Add(-48*time.Hour))
+	ss := &SecretService{secretName: "webhook", backend: &awsBackend{client: fake, secretName: "webhook"}, config: Config{GracePeriod: time.Hour}}
+	ss.refresh()
+	if err := ss.Health(); err != nil {
+		t.Fatalf("Expected a healthy refresh, got %v", err)
+	}
+
+	// the secret is changed by hand
+	fake.versions["v2"] = &fakeVersion{value: `{"ecr-webhook-secret":"new"}`, created: time.Now().Add(-2 * time.Hour)}
+	fake.moveStage(stagePrevious, "v1")
+	fake.moveStage(stageCurrent, "v2")
+	ss.refresh()
+	if !ss.Validate("new") || !ss.Validate("old") {
+		t.Fatalf("Expected the new key and the replaced key within its grace period to be valid")
+	}
+
+	fake.getErr = errors.New("throttled")
+	ss.refresh()
+	err := ss.Health()
+	if err == nil || errors.Is(err, ErrStale) {
+		t.Fatalf("Expected a failing refresh that is not stale yet, got %v", err)
+	}
+	if !ss.Validate("new") {
+		t.Fatalf("Expected the last good key to stay valid")
+	}
+	ss.failingSince = time.Now().Add(-2 * time.Hour)
+	if err := ss.Health(); !errors.Is(err, ErrStale) {
+		t.Fatalf("Expected a stale key after failing past the grace period, got %v", err)
+	}
+
+	fake.getErr = nil
+	ss.refresh()
+	if err := ss.Health(); err != nil {
+		t.Errorf("Expected health to recover, got %v", err)
+	}
+}
+
+func TestHealthWithoutKey(t *testing.T) {
+	fake := newFakeSecretsManager("old", time.Now())
+	fake.getErr = errors.New("access denied")
+	ss := &SecretService{secretName: "webhook", backend: &awsBackend{client: fake, secretName: "webhook"}, config: Config{GracePeriod: time.Hour}}
+	ss.refresh()
+	if err := ss.Health(); !errors.Is(err, ErrStale) {
+		t.Errorf("Expected a stale key when none could be loaded, got %v", err)
+	}
+}
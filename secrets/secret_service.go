@@ -2,133 +2,188 @@ package secrets
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
 	"sync"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 )
 
 type Secrets struct {
 	prevKey        string
 	prevKeyExpirey time.Time
 	currentKey     string
+	// currentClients and prevClients are the named clients of the secret,
+	// prevClients being valid until prevKeyExpirey like prevKey.
+	currentClients []Client
+	prevClients    []Client
+	// version is the Secrets Manager version id of currentKey
+	version string
 }
 
 type SecretService struct {
 	secretName string
 	secrets    Secrets
-	awsClient  *secretsmanager.Client
-	mutex      sync.Mutex
-}
-type awsSecret struct {
-	EcrWebhookSecret string `json:"ecr-webhook-secret"`
+	config     Config
+	backend    Backend
+	// configClients are the clients defined in the config file
+	configClients []Client
+	// pepper is the server secret keys are hashed with
+	pepper []byte
+	quit   chan struct{}
+	mutex  sync.Mutex
+	// refreshErr is the error of the last refresh and failingSince the
+	// time of the first of consecutive failed refreshes.
+	refreshErr   error
+	failingSince time.Time
 }
 
+// ErrStale is wrapped by Health when the loaded key cannot be trusted to be
+// current.
+var ErrStale = errors.New("webhook key is stale")
+
+// Close stops the background key rotation.
 func (ss *SecretService) Close() {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if ss.quit != nil {
+		close(ss.quit)
+		ss.quit = nil
+	}
 }
 
-func NewSecretManager(smc *secretsmanager.Client, region, secretName string) (*SecretService, error) {
-	slog.Info("SecretService created")
+// NewSecretManager creates the service for the backend configured under
+// secrets in the config file. secretName names the secret in Secrets
+// Manager, and by default in SSM and Vault.
+func NewSecretManager(region, secretName string) (*SecretService, error) {
+	config := newConfig()
+	clients, err := configClients(config.Clients)
+	if err != nil {
+		return nil, err
+	}
+	var pepper []byte
+	if config.HashedKeys {
+		if pepper = []byte(os.Getenv(config.PepperEnv)); len(pepper) == 0 {
+			return nil, fmt.Errorf("%w in environment variable %q", errNoPepper, config.PepperEnv)
+		}
+		if err := requireHashed("config", "", clients); err != nil {
+			return nil, err
+		}
+	}
+	backend, err := newBackend(*config, region, secretName)
+	if err != nil {
+		return nil, err
+	}
+	if config.RotationInterval > 0 {
+		if _, ok := backend.(RotatingBackend); !ok {
+			slog.Warn("Secret backend cannot rotate the webhook key, rotationInterval is ignored", "backend", config.Backend)
+		} else if config.HashedKeys {
+			slog.Warn("Hashed keys are not rotated, as callers could not learn the new key; rotationInterval is ignored")
+		}
+	}
+	slog.Info("SecretService created", "backend", config.Backend, "hashedKeys", config.HashedKeys)
 	return &SecretService{
-		awsClient:  smc,
-		secretName: secretName,
+		backend:       backend,
+		secretName:    secretName,
+		config:        *config,
+		configClients: clients,
+		pepper:        pepper,
 	}, nil
 }
 
-func (ss *SecretService) Validate(secret string) bool {
-	slog.Info("validating secret")
-	if secret == ss.secrets.currentKey {
-		return true
-	}
-	if secret == ss.secrets.prevKey && time.Since(ss.secrets.prevKeyExpirey) < 0 {
-		return true
-	}
-	return false
+// HashedKeys reports whether keys are stored hashed, which only bearer
+// tokens can be checked against.
+func (ss *SecretService) HashedKeys() bool {
+	return ss.config.HashedKeys
 }
 
-func (ss *SecretService) getCurrentKeyFromSecretManager() {
-	// Get the current key from AWS Secret Manager
-	slog.Info("secretService:", "secretName", ss.secretName)
-	input := &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(ss.secretName),
-		VersionStage: aws.String("AWSCURRENT"), // VersionStage defaults to AWSCURRENT if unspecified
-	}
+// Validate reports whether secret is the key of any client.
+func (ss *SecretService) Validate(secret string) bool {
+	_, ok := ss.Authenticate(secret)
+	return ok
+}
 
-	result, err := ss.awsClient.GetSecretValue(context.TODO(), input)
-	if err != nil {
-		// For a list of exceptions thrown, see
-		// https://docs.aws.amazon.com/secretsmanager/latest/apireference/API_GetSecretValue.html
-		slog.Error("failed to get client from aws", "error", err)
-		return
+// Authenticate returns the client whose key is secret. Keys replaced within
+// the grace window are still accepted. Comparisons are constant-time.
+func (ss *SecretService) Authenticate(secret string) (Client, bool) {
+	if secret == "" {
+		return Client{}, false
 	}
+	return ss.findClient(func(key string) bool { return ss.keyMatches(secret, key) })
+}
 
-	// Decrypts secret using the associated KMS key.
-	var secretString string = *result.SecretString
+// ValidateSignature reports whether signature is the HMAC-SHA256 of message
+// under the key of any client.
+func (ss *SecretService) ValidateSignature(message, signature []byte) bool {
+	_, ok := ss.AuthenticateSignature(message, signature)
+	return ok
+}
 
-	var secret awsSecret
-	err = json.Unmarshal([]byte(secretString), &secret)
-	if err != nil {
-		slog.Error("Error Unmarshalling secret")
-		return
-	}
-	ss.secrets.currentKey = secret.EcrWebhookSecret
-	slog.Info("currentKey updated successfully")
+// AuthenticateSignature returns the client whose key signature is the
+// HMAC-SHA256 of message under. Signatures need the key itself, so clients
+// whose key is stored hashed never match.
+func (ss *SecretService) AuthenticateSignature(message, signature []byte) (Client, bool) {
+	return ss.findClient(func(key string) bool { return signatureMatches(message, signature, key) })
 }
 
-func (ss *SecretService) uploadCurrentKeyToSecretManager() error {
-	awsSecret := awsSecret{EcrWebhookSecret: ss.secrets.currentKey}
-	secretBytes, err := json.Marshal(&awsSecret)
-	if err != nil {
-		return err
+// findClient returns the first client whose key matches, checking the
+// current keys before the previous ones.
+func (ss *SecretService) findClient(matches func(key string) bool) (Client, bool) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if matches(ss.secrets.currentKey) {
+		return Client{Name: DefaultClient}, true
 	}
-	secretString := string(secretBytes)
-
-	input := &secretsmanager.UpdateSecretInput{
-		SecretId:     aws.String(ss.secretName),
-		SecretString: aws.String(secretString),
+	for _, clients := range [][]Client{ss.secrets.currentClients, ss.configClients} {
+		for _, c := range clients {
+			if matches(c.key) {
+				return c, true
+			}
+		}
 	}
-
-	_, err = ss.awsClient.UpdateSecret(context.TODO(), input)
-	return err
+	if !time.Now().Before(ss.secrets.prevKeyExpirey) {
+		return Client{}, false
+	}
+	if matches(ss.secrets.prevKey) {
+		return Client{Name: DefaultClient}, true
+	}
+	for _, c := range ss.secrets.prevClients {
+		if matches(c.key) {
+			return c, true
+		}
+	}
+	return Client{}, false
 }
 
-func (ss *SecretService) rotateKey() {
-	slog.Info("rotating keys")
-	ss.mutex.Lock()
-	defer ss.mutex.Unlock()
-	oldPrev := &ss.secrets.prevKey
-	ss.secrets.prevKey = ss.secrets.currentKey
-	// allow caller systems cache to clear before we expire the old key
-	ss.secrets.prevKeyExpirey = time.Now().Add(15 * time.Minute)
-	ss.secrets.currentKey = generateKey()
-	err := ss.uploadCurrentKeyToSecretManager()
-	if err != nil {
-		// something went wrong in updating secrets
-		// revert change and log
-		ss.secrets.currentKey = ss.secrets.prevKey
-		ss.secrets.prevKey = *oldPrev
-		slog.Error("error during uploadCurrentKeyToSecretManager", err)
+func signatureMatches(message, signature []byte, key string) bool {
+	if key == "" || isHashedKey(key) {
+		return false
 	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(message)
+	return hmac.Equal(signature, mac.Sum(nil))
 }
 
+// Start loads the keys and keeps checking Secrets Manager for new versions
+// until Close.
 func (sm *SecretService) Start() {
 	slog.Info("managing secrets")
-	sm.getCurrentKeyFromSecretManager()
-	// sm.rotateKey()
-	// Rotate the key every 24 hours
-	ticker := time.NewTicker(24 * time.Hour)
+	sm.refresh()
+	ticker := time.NewTicker(sm.config.RefreshInterval)
 	quit := make(chan struct{})
+	sm.mutex.Lock()
+	sm.quit = quit
+	sm.mutex.Unlock()
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
-				slog.Info("pretending to rotate keys")
-				// sm.rotateKey()
+				sm.refresh()
 			case <-quit:
 				ticker.Stop()
 				return
@@ -137,6 +192,47 @@ func (sm *SecretService) Start() {
 	}()
 }
 
+// refresh runs check and records its result for Health. The loaded keys are
+// left alone when it fails.
+func (sm *SecretService) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	err := sm.check(ctx)
+	if err != nil {
+		slog.Error("Failed to refresh webhook key", "secretName", sm.secretName, "error", err)
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.refreshErr = err
+	if err == nil {
+		sm.failingSince = time.Time{}
+	} else if sm.failingSince.IsZero() {
+		sm.failingSince = time.Now()
+	}
+}
+
+// Health returns the error of the last refresh, or nil when it succeeded.
+// The error wraps ErrStale when no key is loaded or refreshes have failed for
+// longer than the grace period, so the key may no longer be the one callers
+// use.
+func (sm *SecretService) Health() error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if sm.secrets.version == "" {
+		if sm.refreshErr != nil {
+			return fmt.Errorf("%w: no webhook key loaded: %w", ErrStale, sm.refreshErr)
+		}
+		return fmt.Errorf("%w: no webhook key loaded", ErrStale)
+	}
+	if sm.refreshErr == nil {
+		return nil
+	}
+	if time.Since(sm.failingSince) > sm.config.GracePeriod {
+		return fmt.Errorf("%w: refresh failing since %s: %w", ErrStale, sm.failingSince.UTC().Format(time.RFC3339), sm.refreshErr)
+	}
+	return fmt.Errorf("refresh failing since %s: %w", sm.failingSince.UTC().Format(time.RFC3339), sm.refreshErr)
+}
+
 func generateKey() string {
 	key := make([]byte, 32)
 	_, err := rand.Reader.Read(key)
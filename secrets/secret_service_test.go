@@ -0,0 +1,35 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	ss := &SecretService{}
+	ss.secrets.currentKey = "current"
+	ss.secrets.prevKey = "previous"
+	ss.secrets.prevKeyExpirey = time.Now().Add(time.Minute)
+
+	if !ss.Validate("current") {
+		t.Fatalf("Expected current key to be valid")
+	}
+	if !ss.Validate("previous") {
+		t.Fatalf("Expected previous key to be valid within grace window")
+	}
+	if ss.Validate("") || ss.Validate("other") {
+		t.Fatalf("Expected empty and unknown keys to be rejected")
+	}
+
+	ss.secrets.prevKeyExpirey = time.Now().Add(-time.Minute)
+	if ss.Validate("previous") {
+		t.Fatalf("Expected previous key to be rejected after grace window")
+	}
+}
+
+func TestValidateWithoutKey(t *testing.T) {
+	ss := &SecretService{}
+	if ss.Validate("") {
+		t.Fatalf("Expected validation to fail when no key is loaded")
+	}
+}
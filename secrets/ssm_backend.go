@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type ssmClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// ssmBackend reads the secret from an SSM Parameter Store SecureString,
+// which may hold the secret JSON or a bare webhook key. Parameters cannot be
+// updated conditionally, so replicas could overwrite each other's keys and
+// the key is not rotated.
+type ssmBackend struct {
+	client ssmClient
+	name   string
+}
+
+func (b *ssmBackend) Current(ctx context.Context) (Version, error) {
+	return b.get(ctx, b.name)
+}
+
+// Previous returns the parameter version before the current one.
+func (b *ssmBackend) Previous(ctx context.Context) (Version, bool, error) {
+	current, err := b.Current(ctx)
+	if err != nil {
+		return Version{}, false, err
+	}
+	number, err := strconv.ParseInt(current.ID, 10, 64)
+	if err != nil || number <= 1 {
+		return Version{}, false, err
+	}
+	version, err := b.get(ctx, fmt.Sprintf("%s:%d", b.name, number-1))
+	var notFound *types.ParameterVersionNotFound
+	if errors.As(err, &notFound) {
+		return Version{}, false, nil
+	}
+	return version, err == nil, err
+}
+
+// get reads a parameter by name, or by name:version.
+func (b *ssmBackend) get(ctx context.Context, name string) (Version, error) {
+	result, err := b.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return Version{}, err
+	}
+	version, err := localVersion(aws.ToString(result.Parameter.Value), aws.ToTime(result.Parameter.LastModifiedDate))
+	if err != nil {
+		return Version{}, fmt.Errorf("parameter %s: %w", name, err)
+	}
+	// Previous counts back from the parameter version
+	version.ID = strconv.FormatInt(result.Parameter.Version, 10)
+	return version, nil
+}
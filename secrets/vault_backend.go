@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errCasMismatch is returned by a Vault write whose check-and-set version is
+// no longer current.
+var errCasMismatch = errors.New("check-and-set version is not current")
+
+// vaultBackend reads the secret from a Vault KV version 2 engine, or a
+// server speaking its HTTP API.
+type vaultBackend struct {
+	client    *http.Client
+	url       string
+	token     string
+	namespace string
+}
+
+type vaultSecret struct {
+	Data struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata struct {
+			CreatedTime time.Time `json:"created_time"`
+			Version     int64     `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type vaultErrors struct {
+	Errors []string `json:"errors"`
+}
+
+func newVaultBackend(config VaultConfig) (*vaultBackend, error) {
+	if config.Address == "" || config.Path == "" {
+		return nil, fmt.Errorf("vault backend needs an address and a path")
+	}
+	token := os.Getenv(config.TokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("no vault token in environment variable %q", config.TokenEnv)
+	}
+	return &vaultBackend{
+		client:    &http.Client{Timeout: requestTimeout},
+		url:       strings.TrimSuffix(config.Address, "/") + "/v1/" + strings.Trim(config.Mount, "/") + "/data/" + strings.Trim(config.Path, "/"),
+		token:     token,
+		namespace: config.Namespace,
+	}, nil
+}
+
+func (b *vaultBackend) Current(ctx context.Context) (Version, error) {
+	version, _, err := b.read(ctx, 0)
+	return version, err
+}
+
+// Previous returns the KV version before the current one, unless it was
+// deleted.
+func (b *vaultBackend) Previous(ctx context.Context) (Version, bool, error) {
+	current, err := b.Current(ctx)
+	if err != nil {
+		return Version{}, false, err
+	}
+	number, _ := strconv.ParseInt(current.ID, 10, 64)
+	if number <= 1 {
+		return Version{}, false, nil
+	}
+	return b.read(ctx, number-1)
+}
+
+// Rotate writes value with check-and-set on the current version, so only
+// the first of the replicas rotating at the same time succeeds.
+func (b *vaultBackend) Rotate(ctx context.Context, current Version, value string) error {
+	cas, err := strconv.ParseInt(current.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{
+		"options": map[string]int64{"cas": cas},
+		"data":    json.RawMessage(value),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.do(ctx, http.MethodPost, b.url, body)
+	if errors.Is(err, errCasMismatch) {
+		slog.Info("Webhook key was already rotated by another replica", "from", current.ID)
+		return nil
+	}
+	if err == nil {
+		slog.Info("Rotated webhook key", "from", current.ID)
+	}
+	return err
+}
+
+// RotationPending is always false, as a check-and-set write rotates in one
+// step.
+func (b *vaultBackend) RotationPending(ctx context.Context, current Version) (bool, error) {
+	return false, nil
+}
+
+// read returns version number of the secret, or the current version when
+// number is 0. It returns false when the version does not exist or was
+// deleted.
+func (b *vaultBackend) read(ctx context.Context, number int64) (Version, bool, error) {
+	address := b.url
+	if number > 0 {
+		address += "?" + url.Values{"version": {strconv.FormatInt(number, 10)}}.Encode()
+	}
+	data, err := b.do(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return Version{}, false, err
+	}
+	if data == nil {
+		if number > 0 {
+			return Version{}, false, nil
+		}
+		return Version{}, false, fmt.Errorf("vault secret %s not found", b.url)
+	}
+	var secret vaultSecret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return Version{}, false, err
+	}
+	if len(secret.Data.Data) == 0 || string(secret.Data.Data) == "null" {
+		if number > 0 {
+			return Version{}, false, nil
+		}
+		return Version{}, false, fmt.Errorf("vault secret %s has no data", b.url)
+	}
+	return Version{
+		ID:      strconv.FormatInt(secret.Data.Metadata.Version, 10),
+		Created: secret.Data.Metadata.CreatedTime,
+		Value:   string(secret.Data.Data),
+	}, true, nil
+}
+
+// do sends a request to Vault and returns the response body. A 404 of a GET
+// returns no body and no error.
+func (b *vaultBackend) do(ctx context.Context, method, address string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, address, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", b.token)
+	if b.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, nil
+	}
+	if resp.StatusCode >= 300 {
+		var errs vaultErrors
+		json.Unmarshal(data, &errs)
+		message := strings.Join(errs.Errors, "; ")
+		if strings.Contains(message, "check-and-set") {
+			return nil, fmt.Errorf("%w: %s", errCasMismatch, message)
+		}
+		return nil, fmt.Errorf("vault %s %s: %s: %s", method, b.url, resp.Status, message)
+	}
+	return data, nil
+}
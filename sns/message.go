@@ -0,0 +1,65 @@
+package sns
+
+import (
+	"strings"
+)
+
+// Message types sent to HTTP(S) subscriptions in the x-amz-sns-message-type
+// header and the Type field.
+const (
+	TypeSubscriptionConfirmation   = "SubscriptionConfirmation"
+	TypeUnsubscribeConfirmation    = "UnsubscribeConfirmation"
+	TypeNotification               = "Notification"
+	MessageTypeHeader              = "X-Amz-Sns-Message-Type"
+	signatureVersionSHA1           = "1"
+	signatureVersionSHA256         = "2"
+	subscriptionConfirmationFields = "Message MessageId SubscribeURL Timestamp Token TopicArn Type"
+	notificationFields             = "Message MessageId Subject Timestamp TopicArn Type"
+)
+
+// Message is the JSON document SNS posts to HTTP(S) subscriptions.
+type Message struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token,omitempty"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject,omitempty"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL,omitempty"`
+	UnsubscribeURL   string `json:"UnsubscribeURL,omitempty"`
+}
+
+// stringToSign builds the canonical form SNS signs: the name and value of
+// each signed field on their own lines, in byte order of the names.
+// Notifications without a subject leave the Subject field out.
+func (m Message) stringToSign() string {
+	fields := notificationFields
+	if m.Type != TypeNotification {
+		fields = subscriptionConfirmationFields
+	}
+	values := map[string]string{
+		"Message":      m.Message,
+		"MessageId":    m.MessageID,
+		"Subject":      m.Subject,
+		"SubscribeURL": m.SubscribeURL,
+		"Timestamp":    m.Timestamp,
+		"Token":        m.Token,
+		"TopicArn":     m.TopicArn,
+		"Type":         m.Type,
+	}
+	var b strings.Builder
+	for _, field := range strings.Fields(fields) {
+		if field == "Subject" && m.Subject == "" {
+			continue
+		}
+		b.WriteString(field)
+		b.WriteByte('\n')
+		b.WriteString(values[field])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
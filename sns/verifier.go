@@ -0,0 +1,240 @@
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownTopic         = errors.New("topic is not allowed")
+	ErrUnsupportedSignature = errors.New("unsupported signature version")
+	ErrInvalidSignature     = errors.New("invalid message signature")
+	ErrUntrustedURL         = errors.New("url is not an SNS endpoint")
+	ErrInvalidCertificate   = errors.New("invalid signing certificate")
+	ErrStaleMessage         = errors.New("message timestamp is outside the accepted age")
+	ErrUnknownMessageType   = errors.New("unknown message type")
+	ErrConfirmationFailed   = errors.New("subscription confirmation failed")
+)
+
+// snsHost matches the regional SNS endpoints that serve signing
+// certificates and subscription URLs.
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// maxCertificateSize bounds the signing certificate download.
+const maxCertificateSize = 64 << 10
+
+type Config struct {
+	// TopicArns are the topics whose messages are accepted. Messages from
+	// every other topic are rejected, including subscription requests.
+	TopicArns []string `yaml:"topicArns"`
+	// SigningCertFile is a PEM certificate used to verify every message
+	// instead of downloading SigningCertURL, for testing without AWS.
+	SigningCertFile string `yaml:"signingCertFile"`
+	// TrustedHosts may serve signing certificates and subscription URLs in
+	// addition to sns.<region>.amazonaws.com, such as a local SNS emulator.
+	TrustedHosts []string `yaml:"trustedHosts"`
+	// MaxMessageAge rejects messages signed longer ago than this.
+	MaxMessageAge time.Duration `yaml:"maxMessageAge"`
+}
+
+func (c *Config) SetDefaults() {
+	if c.MaxMessageAge <= 0 {
+		c.MaxMessageAge = time.Hour
+	}
+}
+
+// Verifier checks the origin and signature of SNS messages and confirms
+// subscriptions.
+type Verifier struct {
+	config     Config
+	client     *http.Client
+	now        func() time.Time
+	localCert  *x509.Certificate
+	certsMutex sync.Mutex
+	certs      map[string]*x509.Certificate
+}
+
+// NewVerifier creates a verifier for config. It fails when the local
+// signing certificate cannot be loaded.
+func NewVerifier(config Config) (*Verifier, error) {
+	v := &Verifier{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+		certs:  make(map[string]*x509.Certificate),
+	}
+	if config.SigningCertFile != "" {
+		data, err := os.ReadFile(config.SigningCertFile)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := parseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", config.SigningCertFile, err)
+		}
+		v.localCert = cert
+	}
+	return v, nil
+}
+
+// Verify checks that m comes from an allowed topic, is recent and carries a
+// valid signature.
+func (v *Verifier) Verify(ctx context.Context, m Message) error {
+	if !slices.Contains(v.config.TopicArns, m.TopicArn) {
+		return ErrUnknownTopic
+	}
+	switch m.Type {
+	case TypeNotification, TypeSubscriptionConfirmation, TypeUnsubscribeConfirmation:
+	default:
+		return ErrUnknownMessageType
+	}
+	timestamp, err := time.Parse(time.RFC3339, m.Timestamp)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStaleMessage, err)
+	}
+	if age := v.now().Sub(timestamp); age > v.config.MaxMessageAge || age < -v.config.MaxMessageAge {
+		return ErrStaleMessage
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch m.SignatureVersion {
+	case signatureVersionSHA1:
+		sum := sha1.Sum([]byte(m.stringToSign()))
+		hash, digest = crypto.SHA1, sum[:]
+	case signatureVersionSHA256:
+		sum := sha256.Sum256([]byte(m.stringToSign()))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return ErrUnsupportedSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	cert, err := v.certificate(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidCertificate
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Confirm visits the SubscribeURL of a verified subscription confirmation.
+func (v *Verifier) Confirm(ctx context.Context, m Message) error {
+	if err := v.checkURL(m.SubscribeURL); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.SubscribeURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrConfirmationFailed, resp.Status)
+	}
+	return nil
+}
+
+// checkURL accepts https URLs on an SNS endpoint or a trusted host.
+func (v *Verifier) checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrUntrustedURL
+	}
+	host := u.Hostname()
+	if slices.Contains(v.config.TrustedHosts, host) {
+		return nil
+	}
+	if u.Scheme != "https" || !snsHost.MatchString(host) {
+		return ErrUntrustedURL
+	}
+	return nil
+}
+
+// certificate returns the local signing certificate when one is configured,
+// and otherwise downloads and caches the certificate at certURL.
+func (v *Verifier) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if v.localCert != nil {
+		return v.localCert, nil
+	}
+	if err := v.checkURL(certURL); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(certURL, ".pem") {
+		return nil, ErrUntrustedURL
+	}
+	v.certsMutex.Lock()
+	cert, ok := v.certs[certURL]
+	v.certsMutex.Unlock()
+	if ok && v.now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: fetching %s: %s", ErrInvalidCertificate, certURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCertificateSize))
+	if err != nil {
+		return nil, err
+	}
+	cert, err = parseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Fetched SNS signing certificate", "url", certURL, "not-after", cert.NotAfter)
+	v.certsMutex.Lock()
+	v.certs[certURL] = cert
+	v.certsMutex.Unlock()
+	return cert, nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidCertificate
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,185 @@
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTopic = "arn:aws:sns:eu-north-1:123456789012:ecr-events"
+
+var testNow = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func newSigningCert(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    testNow.Add(-time.Hour),
+		NotAfter:     testNow.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, m *Message) {
+	t.Helper()
+	var signature []byte
+	var err error
+	if m.SignatureVersion == signatureVersionSHA1 {
+		sum := sha1.Sum([]byte(m.stringToSign()))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	} else {
+		sum := sha256.Sum256([]byte(m.stringToSign()))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign message: %v", err)
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+func newLocalVerifier(t *testing.T, certPEM []byte) *Verifier {
+	t.Helper()
+	certFile := filepath.Join(t.TempDir(), "sns.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	config := Config{TopicArns: []string{testTopic}, SigningCertFile: certFile}
+	config.SetDefaults()
+	v, err := NewVerifier(config)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func notification() Message {
+	return Message{
+		Type:             TypeNotification,
+		MessageID:        "2f3bd1d4-7c1e-5a0d-8f31-5a9c1f8a1e40",
+		TopicArn:         testTopic,
+		Message:          `{"id":"event-1"}`,
+		Timestamp:        "2024-07-01T11:59:30.123Z",
+		SignatureVersion: signatureVersionSHA256,
+		SigningCertURL:   "https://sns.eu-north-1.amazonaws.com/SimpleNotificationService-abc.pem",
+	}
+}
+
+func TestVerifierVerify(t *testing.T) {
+	key, certPEM := newSigningCert(t)
+	v := newLocalVerifier(t, certPEM)
+
+	for _, version := range []string{signatureVersionSHA1, signatureVersionSHA256} {
+		m := notification()
+		m.SignatureVersion = version
+		sign(t, key, &m)
+		if err := v.Verify(context.Background(), m); err != nil {
+			t.Errorf("Expected signature version %s to verify, got %v", version, err)
+		}
+	}
+
+	confirmation := notification()
+	confirmation.Type = TypeSubscriptionConfirmation
+	confirmation.Token = "token"
+	confirmation.SubscribeURL = "https://sns.eu-north-1.amazonaws.com/?Action=ConfirmSubscription"
+	sign(t, key, &confirmation)
+	if err := v.Verify(context.Background(), confirmation); err != nil {
+		t.Errorf("Expected subscription confirmation to verify, got %v", err)
+	}
+
+	tests := map[string]struct {
+		modify func(m *Message)
+		err    error
+	}{
+		"tampered message": {func(m *Message) { m.Message = `{"id":"event-2"}` }, ErrInvalidSignature},
+		"unknown topic":    {func(m *Message) { m.TopicArn = "arn:aws:sns:eu-north-1:999999999999:other" }, ErrUnknownTopic},
+		"stale":            {func(m *Message) { m.Timestamp = "2024-07-01T09:00:00.000Z" }, ErrStaleMessage},
+		"unknown version":  {func(m *Message) { m.SignatureVersion = "3" }, ErrUnsupportedSignature},
+		"unknown type":     {func(m *Message) { m.Type = "Other" }, ErrUnknownMessageType},
+	}
+	for name, test := range tests {
+		m := notification()
+		sign(t, key, &m)
+		test.modify(&m)
+		if err := v.Verify(context.Background(), m); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", name, test.err, err)
+		}
+	}
+}
+
+func TestVerifierFetchesCertificate(t *testing.T) {
+	key, certPEM := newSigningCert(t)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fetches++
+		rw.Write(certPEM)
+	}))
+	defer server.Close()
+
+	config := Config{TopicArns: []string{testTopic}, TrustedHosts: []string{"127.0.0.1"}}
+	config.SetDefaults()
+	v, err := NewVerifier(config)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	v.now = func() time.Time { return testNow }
+
+	m := notification()
+	m.SigningCertURL = server.URL + "/SimpleNotificationService-abc.pem"
+	sign(t, key, &m)
+	for i := 0; i < 2; i++ {
+		if err := v.Verify(context.Background(), m); err != nil {
+			t.Fatalf("Expected message to verify, got %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the certificate to be fetched once, got %d", fetches)
+	}
+
+	m.SigningCertURL = "https://attacker.example.com/SimpleNotificationService-abc.pem"
+	sign(t, key, &m)
+	if err := v.Verify(context.Background(), m); !errors.Is(err, ErrUntrustedURL) {
+		t.Errorf("Expected untrusted certificate URL to be rejected, got %v", err)
+	}
+}
+
+func TestVerifierCheckURL(t *testing.T) {
+	v := &Verifier{config: Config{TrustedHosts: []string{"localhost"}}}
+	tests := map[string]bool{
+		"https://sns.eu-north-1.amazonaws.com/cert.pem":       true,
+		"https://sns.cn-north-1.amazonaws.com.cn/cert.pem":    true,
+		"http://localhost:4566/cert.pem":                      true,
+		"http://sns.eu-north-1.amazonaws.com/cert.pem":        false,
+		"https://sns.eu-north-1.amazonaws.com.evil/cert.pem":  false,
+		"https://evil.com/sns.eu-north-1.amazonaws.com/c.pem": false,
+	}
+	for rawURL, ok := range tests {
+		if err := v.checkURL(rawURL); (err == nil) != ok {
+			t.Errorf("checkURL(%s) = %v, expected ok %v", rawURL, err, ok)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package sqs_listener
+
+import (
+	"fmt"
+	"time"
+)
+
+type Config struct {
+	// QueueURL is the queue fed by the ECR EventBridge rule. Pull mode is
+	// enabled when it is set.
+	QueueURL string `yaml:"queueUrl"`
+	// Endpoint overrides the SQS endpoint, for a local SQS compatible server.
+	Endpoint string `yaml:"endpoint"`
+	// Region overrides the region of the receiver.
+	Region string `yaml:"region"`
+	// WaitTime is how long a receive waits for messages, at most 20 seconds.
+	WaitTime time.Duration `yaml:"waitTime"`
+	// MaxMessages is how many messages one receive returns, at most 10.
+	MaxMessages int32 `yaml:"maxMessages"`
+	// VisibilityTimeout hides a received message from other receivers until
+	// it is handled. Zero uses the queue default.
+	VisibilityTimeout time.Duration `yaml:"visibilityTimeout"`
+	// DeadLetterQueueURL receives poison messages. Without it they stay on
+	// the queue for its redrive policy to move.
+	DeadLetterQueueURL string `yaml:"deadLetterQueueUrl"`
+	// MaxReceives is how often a message is attempted before it is moved to
+	// the dead letter queue.
+	MaxReceives int `yaml:"maxReceives"`
+}
+
+func (c *Config) SetDefaults() {
+	if c.WaitTime <= 0 {
+		c.WaitTime = 20 * time.Second
+	}
+	if c.MaxMessages <= 0 {
+		c.MaxMessages = 10
+	}
+	if c.MaxReceives <= 0 {
+		c.MaxReceives = 5
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.WaitTime > 20*time.Second {
+		return fmt.Errorf("sqs.waitTime must be at most 20s")
+	}
+	if c.MaxMessages > 10 {
+		return fmt.Errorf("sqs.maxMessages must be at most 10")
+	}
+	if c.VisibilityTimeout > 12*time.Hour {
+		return fmt.Errorf("sqs.visibilityTimeout must be at most 12h")
+	}
+	return nil
+}
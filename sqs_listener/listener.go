@@ -0,0 +1,173 @@
+package sqs_listener
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// ErrPoison marks messages that can never be handled, such as bodies that
+// are not events. They are moved to the dead letter queue without retrying.
+var ErrPoison = errors.New("poison message")
+
+// Handler processes the body of one message. The message is deleted when
+// it returns nil and received again later when it fails.
+type Handler func(ctx context.Context, body []byte) error
+
+// Client is the part of *sqs.Client the listener uses.
+type Client interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+	// requestTimeout bounds the requests that settle a handled message,
+	// which run after the listener was stopped.
+	requestTimeout = 10 * time.Second
+	// failureReasonAttribute is set on messages moved to the dead letter queue.
+	failureReasonAttribute = "FailureReason"
+)
+
+// Listener long-polls an SQS queue and hands each message to a handler.
+type Listener struct {
+	config  Config
+	client  Client
+	handler Handler
+	log     *slog.Logger
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewListener(config Config, client Client, handler Handler) *Listener {
+	return &Listener{
+		config:  config,
+		client:  client,
+		handler: handler,
+		log:     slog.With("queue-url", config.QueueURL),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start polls the queue in the background until Stop is called.
+func (l *Listener) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.run(ctx)
+	l.log.Info("Polling SQS queue for events")
+}
+
+// Stop ends polling and waits for the message being handled, or until ctx
+// is done.
+func (l *Listener) Stop(ctx context.Context) error {
+	l.once.Do(func() {
+		if l.cancel != nil {
+			l.cancel()
+		} else {
+			close(l.done)
+		}
+	})
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Listener) run(ctx context.Context) {
+	defer close(l.done)
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		out, err := l.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    &l.config.QueueURL,
+			MaxNumberOfMessages:         l.config.MaxMessages,
+			WaitTimeSeconds:             int32(l.config.WaitTime / time.Second),
+			VisibilityTimeout:           int32(l.config.VisibilityTimeout / time.Second),
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			l.log.Error("Failed to receive messages", "error", err, "retry-in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxBackoff)
+			continue
+		}
+		backoff = minBackoff
+		for _, message := range out.Messages {
+			// messages already received are handled even when stopping, as
+			// they stay invisible on the queue until the timeout
+			l.handle(context.WithoutCancel(ctx), message)
+		}
+	}
+}
+
+func (l *Listener) handle(ctx context.Context, message types.Message) {
+	log := l.log.With("message-id", value(message.MessageId))
+	err := l.handler(ctx, []byte(value(message.Body)))
+	if err == nil {
+		l.delete(ctx, log, message)
+		return
+	}
+	receives, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	if !errors.Is(err, ErrPoison) && receives < l.config.MaxReceives {
+		log.Warn("Failed to handle message, it will be received again", "error", err, "receives", receives)
+		return
+	}
+	if l.config.DeadLetterQueueURL == "" {
+		log.Error("Failed to handle message, leaving it to the queue redrive policy", "error", err, "receives", receives)
+		return
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	reason := err.Error()
+	stringType := "String"
+	_, sendErr := l.client.SendMessage(sendCtx, &sqs.SendMessageInput{
+		QueueUrl:    &l.config.DeadLetterQueueURL,
+		MessageBody: message.Body,
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			failureReasonAttribute: {DataType: &stringType, StringValue: &reason},
+		},
+	})
+	if sendErr != nil {
+		log.Error("Failed to move message to the dead letter queue", "error", sendErr)
+		return
+	}
+	log.Error("Moved message to the dead letter queue", "error", err, "receives", receives)
+	l.delete(ctx, log, message)
+}
+
+func (l *Listener) delete(ctx context.Context, log *slog.Logger, message types.Message) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	_, err := l.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &l.config.QueueURL,
+		ReceiptHandle: message.ReceiptHandle,
+	})
+	if err != nil {
+		// the message is received again and recognised as a duplicate
+		log.Error("Failed to delete message", "error", err)
+	}
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
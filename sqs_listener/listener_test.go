@@ -0,0 +1,114 @@
+package sqs_listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+type fakeClient struct {
+	mutex    sync.Mutex
+	messages []types.Message
+	deleted  []string
+	dead     []string
+}
+
+func (f *fakeClient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.mutex.Lock()
+	messages := f.messages
+	f.messages = nil
+	f.mutex.Unlock()
+	if len(messages) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (f *fakeClient) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.deleted = append(f.deleted, *params.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.dead = append(f.dead, *params.MessageBody)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func message(body string, receives int) types.Message {
+	return types.Message{
+		MessageId:     &body,
+		Body:          &body,
+		ReceiptHandle: &body,
+		Attributes: map[string]string{
+			string(types.MessageSystemAttributeNameApproximateReceiveCount): fmt.Sprint(receives),
+		},
+	}
+}
+
+func TestListenerHandlesMessages(t *testing.T) {
+	client := &fakeClient{messages: []types.Message{
+		message("ok", 1),
+		message("poison", 1),
+		message("transient", 1),
+		message("exhausted", 5),
+	}}
+	handled := make(chan string, 4)
+	config := Config{QueueURL: "http://localhost:4566/000000000000/ecr-events", DeadLetterQueueURL: "dlq"}
+	config.SetDefaults()
+	listener := NewListener(config, client, func(ctx context.Context, body []byte) error {
+		handled <- string(body)
+		switch string(body) {
+		case "poison":
+			return fmt.Errorf("%w: not an event", ErrPoison)
+		case "transient", "exhausted":
+			return errors.New("queue full")
+		}
+		return nil
+	})
+	listener.Start()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 4 messages to be handled, got %d", i)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := listener.Stop(ctx); err != nil {
+		t.Fatalf("Failed to stop listener: %v", err)
+	}
+
+	expectedDeleted := []string{"ok", "poison", "exhausted"}
+	if fmt.Sprint(client.deleted) != fmt.Sprint(expectedDeleted) {
+		t.Errorf("Expected deleted messages %v, got %v", expectedDeleted, client.deleted)
+	}
+	expectedDead := []string{"poison", "exhausted"}
+	if fmt.Sprint(client.dead) != fmt.Sprint(expectedDead) {
+		t.Errorf("Expected dead lettered messages %v, got %v", expectedDead, client.dead)
+	}
+}
+
+func TestListenerKeepsPoisonWithoutDeadLetterQueue(t *testing.T) {
+	client := &fakeClient{}
+	config := Config{QueueURL: "queue"}
+	config.SetDefaults()
+	listener := NewListener(config, client, func(ctx context.Context, body []byte) error {
+		return ErrPoison
+	})
+	listener.handle(context.Background(), message("poison", 1))
+	if len(client.deleted) != 0 || len(client.dead) != 0 {
+		t.Errorf("Expected poison message to stay on the queue, deleted %v, dead %v", client.deleted, client.dead)
+	}
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+// webhookCaller is the caller name of requests authenticated with the shared
+// webhook key.
+const webhookCaller = secrets.DefaultClient
+
+// pollerCaller is the caller name of pushes found by the ECR poller.
+const pollerCaller = "poller"
+
+var (
+	ErrMissingAuthorization = errors.New("missing authorization header")
+	ErrInvalidAuthorization = errors.New("malformed authorization header")
+	ErrInvalidToken         = errors.New("invalid token")
+	ErrNotAllowed           = errors.New("image is not allowed for caller")
+)
+
+// authChallenge builds the WWW-Authenticate value returned with a 401, or an
+// empty string when the auth mode has no HTTP challenge.
+func (w *Web) authChallenge(err error) string {
+	switch w.config.Auth.Mode {
+	case AuthModeHmac:
+		return `HMAC-SHA256 realm="ecr-change-receiver", headers="` +
+			timestampHeader + " " + nonceHeader + " " + signatureHeader + `"`
+	case AuthModeMtls:
+		return ""
+	}
+	challenge := `Bearer realm="ecr-change-receiver"`
+	switch {
+	case errors.Is(err, ErrInvalidAuthorization):
+		challenge += `, error="invalid_request"`
+	case errors.Is(err, ErrInvalidToken):
+		challenge += `, error="invalid_token"`
+	}
+	return challenge
+}
+
+func (w *Web) writeUnauthorized(rw http.ResponseWriter, r *http.Request, err error) {
+	if challenge := w.authChallenge(err); challenge != "" {
+		rw.Header().Set("WWW-Authenticate", challenge)
+	}
+	writeProblem(rw, r, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+}
+
+// authorizeRequest authenticates a webhook request using the configured auth
+// mode and returns the caller, whose permissions the handlers check against
+// the images it asks to deploy. body is the raw request body, which hmac
+// mode signs.
+func (w *Web) authorizeRequest(r *http.Request, body []byte) (secrets.Client, error) {
+	switch w.config.Auth.Mode {
+	case AuthModeHmac:
+		caller, err := w.hmacVerifier.verify(r, body)
+		if err != nil {
+			slog.Info("Rejected signed request", "reason", err.Error())
+		}
+		return caller, err
+	case AuthModeMtls:
+		caller, err := w.mtlsAuthenticator.authenticate(r)
+		if err != nil {
+			slog.Info("Rejected client certificate", "reason", err.Error())
+		}
+		return caller, err
+	}
+	return w.authorizeBearer(r)
+}
+
+// authorizeAdmin authenticates requests to the read and management endpoints,
+// which carry no body, and writes the 401 response when they are rejected.
+func (w *Web) authorizeAdmin(rw http.ResponseWriter, r *http.Request) (secrets.Client, bool) {
+	caller, err := w.authorizeRequest(r, nil)
+	if err != nil {
+		w.writeUnauthorized(rw, r, err)
+		return secrets.Client{}, false
+	}
+	return caller, true
+}
+
+// checkAllowed writes a 403 response and returns false when caller may not
+// deploy tag of repository.
+func checkAllowed(rw http.ResponseWriter, r *http.Request, caller secrets.Client, repository, tag string) bool {
+	if caller.Allows(repository, tag) {
+		return true
+	}
+	slog.Info("Rejected image not allowed for caller", "caller", caller.Name, "repository", repository, "image-tag", tag)
+	writeProblem(rw, r, http.StatusForbidden, CodeForbidden, notAllowed(caller, repository, tag).Error())
+	return false
+}
+
+func notAllowed(caller secrets.Client, repository, tag string) error {
+	return fmt.Errorf("%w: %s may not deploy %s:%s", ErrNotAllowed, caller.Name, strings.TrimPrefix(repository, "/"), tag)
+}
+
+func (w *Web) authorizeBearer(r *http.Request) (secrets.Client, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		slog.Info("No authorization header")
+		return secrets.Client{}, ErrMissingAuthorization
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		slog.Info("Unsupported authorization scheme")
+		return secrets.Client{}, ErrInvalidAuthorization
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return secrets.Client{}, ErrInvalidAuthorization
+	}
+	caller, ok := w.secretmanager.Authenticate(token)
+	if !ok {
+		slog.Info("Invalid bearer token")
+		return secrets.Client{}, ErrInvalidToken
+	}
+	return caller, nil
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var ErrInvalidClientAddress = errors.New("could not determine client address")
+
+// parsePrefixes parses CIDR ranges, accepting plain addresses as single-host
+// ranges.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedBy reports whether addr is in allowlist. An empty allowlist allows
+// every address.
+func allowedBy(allowlist []netip.Prefix, addr netip.Addr) bool {
+	return len(allowlist) == 0 || containsAddr(allowlist, addr)
+}
+
+// clientIPResolver finds the address of the client that sent a request. The
+// Forwarded and X-Forwarded-For headers are only believed for hops that
+// arrive through a trusted proxy.
+type clientIPResolver struct {
+	trustedProxies []netip.Prefix
+}
+
+func (c *clientIPResolver) clientIP(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, ErrInvalidClientAddress
+	}
+	remote = remote.Unmap()
+	if !containsAddr(c.trustedProxies, remote) {
+		return remote, nil
+	}
+
+	hops := forwardedHops(r.Header)
+	// walk from the hop closest to us and stop at the first address that
+	// was not added by a trusted proxy
+	client := remote
+	for n := len(hops) - 1; n >= 0; n-- {
+		addr, ok := parseHop(hops[n])
+		if !ok {
+			// obfuscated or garbled entries cannot be trusted further
+			return client, nil
+		}
+		client = addr
+		if !containsAddr(c.trustedProxies, addr) {
+			return client, nil
+		}
+	}
+	return client, nil
+}
+
+// forwardedHops returns the client addresses recorded by proxies, oldest
+// first, preferring the standard Forwarded header over X-Forwarded-For.
+func forwardedHops(header http.Header) []string {
+	var hops []string
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, value := range forwarded {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(key, "for") {
+						hops = append(hops, value)
+					}
+				}
+			}
+		}
+		return hops
+	}
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHop parses an address from X-Forwarded-For or a Forwarded for=
+// parameter, which may be quoted, bracketed and carry a port.
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	addr, err := netip.ParseAddr(hop)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parsePrefixes([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Failed to parse prefixes: %v", err)
+	}
+	resolver := &clientIPResolver{trustedProxies: trusted}
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:51234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"behind load balancer", "10.1.2.3:443", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed prefix behind load balancer", "10.1.2.3:443", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:443", map[string]string{"X-Forwarded-For": "198.51.100.1, 192.0.2.1, 10.9.9.9"}, "198.51.100.1"},
+		{"forwarded header", "10.1.2.3:443", map[string]string{"Forwarded": `for=198.51.100.1;proto=https, for="[2001:db8::17]:4711"`}, "2001:db8::17"},
+		{"forwarded preferred", "10.1.2.3:443", map[string]string{"Forwarded": "for=198.51.100.2", "X-Forwarded-For": "198.51.100.1"}, "198.51.100.2"},
+		{"obfuscated hop", "10.1.2.3:443", map[string]string{"Forwarded": "for=_hidden"}, "10.1.2.3"},
+		{"no header", "10.1.2.3:443", nil, "10.1.2.3"},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest("POST", "/update", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		addr, err := resolver.clientIP(r)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if addr.String() != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, addr)
+		}
+	}
+}
+
+func TestAllowedBy(t *testing.T) {
+	allowlist, err := parsePrefixes([]string{"198.51.100.0/24", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("Failed to parse prefixes: %v", err)
+	}
+	if !allowedBy(allowlist, netip.MustParseAddr("198.51.100.200")) || !allowedBy(allowlist, netip.MustParseAddr("2001:db8::1")) {
+		t.Errorf("Expected addresses inside the allowlist to be allowed")
+	}
+	if allowedBy(allowlist, netip.MustParseAddr("203.0.113.1")) {
+		t.Errorf("Expected address outside the allowlist to be rejected")
+	}
+	if !allowedBy(nil, netip.MustParseAddr("203.0.113.1")) {
+		t.Errorf("Expected empty allowlist to allow everything")
+	}
+	if _, err := parsePrefixes([]string{"not-an-ip"}); err == nil {
+		t.Errorf("Expected invalid entry to be rejected")
+	}
+}
@@ -0,0 +1,262 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"ljos.app/ecr-change-receiver/journal"
+	"ljos.app/ecr-change-receiver/sns"
+	"ljos.app/ecr-change-receiver/sqs_listener"
+)
+
+// Route names used as keys of Config.MaxBodyBytes.
+const (
+	RouteUpdate    = "update"
+	RouteSNS       = "sns"
+	RouteRegistry  = "registry"
+	RouteDockerHub = "dockerhub"
+	RouteGitHub    = "github"
+)
+
+// defaultMaxBodyBytes are the body limits of routes missing from
+// Config.MaxBodyBytes. EventBridge events and SNS messages are at most
+// 256 KiB, SNS escapes the message into its envelope and GitHub package
+// events carry the image manifest.
+var defaultMaxBodyBytes = map[string]int64{
+	RouteUpdate:    256 << 10,
+	RouteSNS:       512 << 10,
+	RouteRegistry:  256 << 10,
+	RouteDockerHub: 64 << 10,
+	RouteGitHub:    1 << 20,
+}
+
+const (
+	AuthModeBearer = "bearer"
+	AuthModeHmac   = "hmac"
+	AuthModeMtls   = "mtls"
+)
+
+// MtlsCaller names the client certificates that act as one caller.
+type MtlsCaller struct {
+	Name string `yaml:"name"`
+	// Identities are certificate subject common names or DNS, URI or email
+	// subject alternative names.
+	Identities []string `yaml:"identities"`
+	// Repositories and TagPrefixes limit which images the caller may
+	// deploy. An empty list allows all.
+	Repositories []string `yaml:"repositories"`
+	TagPrefixes  []string `yaml:"tagPrefixes"`
+}
+
+type MtlsConfig struct {
+	// ClientCAFile holds the PEM encoded CAs that client certificates must chain to.
+	ClientCAFile string       `yaml:"clientCAFile"`
+	Callers      []MtlsCaller `yaml:"callers"`
+}
+
+type AuthConfig struct {
+	// Mode selects how webhook requests are authenticated, either "bearer" (default), "hmac" or "mtls".
+	Mode string `yaml:"mode"`
+	// MaxClockSkew is how far the signature timestamp may drift from the receiver clock in hmac mode.
+	MaxClockSkew time.Duration `yaml:"maxClockSkew"`
+	Mtls         MtlsConfig    `yaml:"mtls"`
+}
+
+type DeploymentsConfig struct {
+	// Workers is the number of repositories that can be deployed in parallel.
+	Workers int `yaml:"workers"`
+	// MaxQueued is how many deployments may wait before webhooks are rejected.
+	MaxQueued int `yaml:"maxQueued"`
+	// History is how many deployments are kept for the /deployments endpoints.
+	History int `yaml:"history"`
+	// DeduplicationWindow is how long event ids and pushed image digests are
+	// remembered to recognise repeated deliveries.
+	DeduplicationWindow time.Duration `yaml:"deduplicationWindow"`
+}
+
+type TLSConfig struct {
+	// CertFile and KeyFile enable TLS. They are reloaded when they change on disk.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// MinVersion is the lowest accepted TLS version, "1.2" (default) or "1.3".
+	MinVersion string `yaml:"minVersion"`
+}
+
+type ListenConfig struct {
+	// Address is the host and port the server listens on.
+	Address           string        `yaml:"address"`
+	TLS               TLSConfig     `yaml:"tls"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+}
+
+type NetworkConfig struct {
+	// TrustedProxies are the CIDR ranges of proxies, such as a load balancer,
+	// whose Forwarded and X-Forwarded-For headers name the real client.
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// WebhookAllowlist limits which client addresses may send webhooks. An
+	// empty list allows every address.
+	WebhookAllowlist []string `yaml:"webhookAllowlist"`
+	// AdminAllowlist limits which client addresses may use the /deployments
+	// and /images endpoints. An empty list allows every address.
+	AdminAllowlist []string `yaml:"adminAllowlist"`
+}
+
+type DockerHubConfig struct {
+	// TokenEnv names the environment variable holding the token Docker Hub
+	// must send as the token query parameter, as it cannot sign or add
+	// headers. The /dockerhub endpoint is enabled when it is set.
+	TokenEnv string `yaml:"tokenEnv"`
+}
+
+type GitHubConfig struct {
+	// SecretEnv names the environment variable holding the webhook secret
+	// GitHub signs X-Hub-Signature-256 with. The /github endpoint is enabled
+	// when it is set.
+	SecretEnv string `yaml:"secretEnv"`
+}
+
+// AdaptersConfig configures the webhooks of registries other than ECR that
+// verify their requests themselves instead of using the auth mode.
+type AdaptersConfig struct {
+	DockerHub DockerHubConfig `yaml:"dockerHub"`
+	GitHub    GitHubConfig    `yaml:"github"`
+}
+
+type Config struct {
+	Listen ListenConfig `yaml:"listen"`
+	// ShutdownTimeout is how long running deployments may take to finish or
+	// roll back after a shutdown signal.
+	ShutdownTimeout time.Duration     `yaml:"shutdownTimeout"`
+	Auth            AuthConfig        `yaml:"auth"`
+	Deployments     DeploymentsConfig `yaml:"deployments"`
+	Network         NetworkConfig     `yaml:"network"`
+	// MaxBodyBytes limits the request body size per route.
+	MaxBodyBytes map[string]int64 `yaml:"maxBodyBytes"`
+	// SNS enables the /sns subscription endpoint when topics are configured.
+	SNS sns.Config `yaml:"sns"`
+	// SQS enables pull mode, receiving events from an SQS queue, when a queue
+	// URL is configured.
+	SQS      sqs_listener.Config `yaml:"sqs"`
+	Adapters AdaptersConfig      `yaml:"adapters"`
+	// Journal records every webhook request and its outcome for replay.
+	Journal journal.Config `yaml:"journal"`
+}
+
+type fileConfig struct {
+	Web Config `yaml:"web"`
+}
+
+func (c *Config) setDefaults() {
+	if c.MaxBodyBytes == nil {
+		c.MaxBodyBytes = make(map[string]int64)
+	}
+	for route, limit := range defaultMaxBodyBytes {
+		if c.MaxBodyBytes[route] <= 0 {
+			c.MaxBodyBytes[route] = limit
+		}
+	}
+	c.SNS.SetDefaults()
+	c.SQS.SetDefaults()
+	c.Journal.SetDefaults()
+	if c.Listen.Address == "" {
+		c.Listen.Address = ":8080"
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = time.Minute
+	}
+	if c.Listen.TLS.MinVersion == "" {
+		c.Listen.TLS.MinVersion = "1.2"
+	}
+	if c.Listen.ReadHeaderTimeout == 0 {
+		c.Listen.ReadHeaderTimeout = 10 * time.Second
+	}
+	if c.Listen.ReadTimeout == 0 {
+		c.Listen.ReadTimeout = 30 * time.Second
+	}
+	if c.Listen.WriteTimeout == 0 {
+		c.Listen.WriteTimeout = 30 * time.Second
+	}
+	if c.Listen.IdleTimeout == 0 {
+		c.Listen.IdleTimeout = 2 * time.Minute
+	}
+	if c.Auth.Mode == "" {
+		c.Auth.Mode = AuthModeBearer
+	}
+	if c.Auth.MaxClockSkew == 0 {
+		c.Auth.MaxClockSkew = 5 * time.Minute
+	}
+	if c.Deployments.Workers <= 0 {
+		c.Deployments.Workers = 4
+	}
+	if c.Deployments.MaxQueued <= 0 {
+		c.Deployments.MaxQueued = 100
+	}
+	if c.Deployments.History <= 0 {
+		c.Deployments.History = 200
+	}
+	if c.Deployments.DeduplicationWindow <= 0 {
+		c.Deployments.DeduplicationWindow = 10 * time.Minute
+	}
+}
+
+func (c *Config) validate() error {
+	if (c.Listen.TLS.CertFile == "") != (c.Listen.TLS.KeyFile == "") {
+		return fmt.Errorf("listen.tls needs both certFile and keyFile")
+	}
+	if _, err := parseTLSVersion(c.Listen.TLS.MinVersion); err != nil {
+		return err
+	}
+	if err := c.SQS.Validate(); err != nil {
+		return err
+	}
+	for _, prefixes := range [][]string{c.Network.TrustedProxies, c.Network.WebhookAllowlist, c.Network.AdminAllowlist} {
+		if _, err := parsePrefixes(prefixes); err != nil {
+			return err
+		}
+	}
+	switch c.Auth.Mode {
+	case AuthModeBearer, AuthModeHmac:
+	case AuthModeMtls:
+		if c.Listen.TLS.CertFile == "" || c.Auth.Mtls.ClientCAFile == "" {
+			return fmt.Errorf("auth mode mtls needs listen.tls and auth.mtls.clientCAFile")
+		}
+	default:
+		return fmt.Errorf("unknown auth mode %q", c.Auth.Mode)
+	}
+	return nil
+}
+
+func newConfig() *Config {
+	c := &fileConfig{}
+	data, err := os.ReadFile("./conf/conf.yml")
+	if err != nil {
+		panic(err)
+	}
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		panic(err)
+	}
+	c.Web.setDefaults()
+	if err := c.Web.validate(); err != nil {
+		panic(err)
+	}
+	return &c.Web
+}
+
+var errNoSecret = errors.New("secret is not set")
+
+// adapterSecret reads the secret of an adapter from the environment
+// variable named env.
+func adapterSecret(env string) ([]byte, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return nil, fmt.Errorf("%s: %w", env, errNoSecret)
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,24 @@
+package web
+
+import (
+	"net/http"
+)
+
+func (w *Web) listDeployments(rw http.ResponseWriter, r *http.Request) {
+	if _, ok := w.authorizeAdmin(rw, r); !ok {
+		return
+	}
+	writeJSON(rw, http.StatusOK, w.history.List())
+}
+
+func (w *Web) getDeployment(rw http.ResponseWriter, r *http.Request) {
+	if _, ok := w.authorizeAdmin(rw, r); !ok {
+		return
+	}
+	record, ok := w.history.Get(r.PathValue("id"))
+	if !ok {
+		writeProblem(rw, r, http.StatusNotFound, CodeNotFound, "deployment not found")
+		return
+	}
+	writeJSON(rw, http.StatusOK, record)
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+const dockerHubCaller = "dockerhub"
+
+// handleDockerHub receives Docker Hub repository webhooks. Docker Hub
+// neither signs its requests nor sends custom headers, so the webhook URL
+// carries a token query parameter instead.
+func (w *Web) handleDockerHub(rw http.ResponseWriter, r *http.Request) {
+	if w.ratelimiter.RateLimitsExceeded(clientAddr(r)) {
+		writeProblem(rw, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), w.dockerHubToken) != 1 {
+		journalAuth(r, dockerHubCaller, ErrInvalidToken)
+		slog.Info("Rejected Docker Hub webhook", "reason", ErrInvalidToken.Error())
+		writeProblem(rw, r, http.StatusUnauthorized, CodeUnauthorized, ErrInvalidToken.Error())
+		return
+	}
+	journalAuth(r, dockerHubCaller, nil)
+	if !requireJSON(rw, r) {
+		return
+	}
+	body, ok := readBody(rw, r, w.config.MaxBodyBytes[RouteDockerHub])
+	if !ok {
+		return
+	}
+	var event events.DockerHubEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	if reason := event.IgnoreReason(); reason != "" {
+		slog.Info("Ignoring Docker Hub event", "reason", reason)
+		writeWebhookResult(rw, r, webhookResult{Status: "ignored", Reason: reason}, nil)
+		return
+	}
+	result, err := w.handleImageEvent(secrets.Client{Name: dockerHubCaller}, event.ImageEvent())
+	writeWebhookResult(rw, r, result, err)
+}
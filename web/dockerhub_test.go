@@ -0,0 +1,39 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/image_watcher"
+)
+
+func TestHandleDockerHub(t *testing.T) {
+	w := newTestWeb(map[string]map[string]image_watcher.Image{
+		"/acme/app": {"v": {RepositoryName: "/acme/app", ImageTag: "v1", Registry: events.RegistryDockerHub}},
+	}, nil, func(w *Web) {
+		w.dockerHubToken = []byte("hub-token")
+	})
+	body := `{"push_data":{"pushed_at":1719835200,"pusher":"acme","tag":"v2"},"repository":{"repo_name":"acme/app","name":"app","namespace":"acme"}}`
+
+	for _, target := range []string{"/dockerhub", "/dockerhub?token=", "/dockerhub?token=other"} {
+		rec := serve(w, http.MethodPost, target, "", body)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", target, rec.Code)
+			continue
+		}
+		if p := decodeProblem(t, rec); p.Code != CodeUnauthorized {
+			t.Errorf("%s: expected code %s, got %s", target, CodeUnauthorized, p.Code)
+		}
+	}
+
+	rec := serve(w, http.MethodPost, "/dockerhub?token=hub-token", "", body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the push to be queued, got %d %s", rec.Code, rec.Body)
+	}
+	result := decodeResult(t, rec)
+	record, ok := w.history.Get(result.DeploymentIDs[0])
+	if !ok || record.Repository != "/acme/app" || record.Tag != "v2" || record.Caller != dockerHubCaller {
+		t.Errorf("Unexpected deployment %+v", record)
+	}
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+const (
+	gitHubSignatureHeader = "X-Hub-Signature-256"
+	gitHubEventHeader     = "X-GitHub-Event"
+	gitHubDeliveryHeader  = "X-GitHub-Delivery"
+	gitHubCaller          = "github"
+)
+
+// verifyGitHubSignature checks the X-Hub-Signature-256 header, the
+// HMAC-SHA256 of body keyed with the webhook secret.
+func verifyGitHubSignature(secret []byte, body []byte, header string) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil || !strings.HasPrefix(header, "sha256=") {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// handleGitHub receives package and registry_package webhooks for images
+// published to GitHub Container Registry.
+func (w *Web) handleGitHub(rw http.ResponseWriter, r *http.Request) {
+	if w.ratelimiter.RateLimitsExceeded(clientAddr(r)) {
+		writeProblem(rw, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+		return
+	}
+	if !requireJSON(rw, r) {
+		return
+	}
+	body, ok := readBody(rw, r, w.config.MaxBodyBytes[RouteGitHub])
+	if !ok {
+		return
+	}
+	err := verifyGitHubSignature(w.gitHubSecret, body, r.Header.Get(gitHubSignatureHeader))
+	journalAuth(r, gitHubCaller, err)
+	if err != nil {
+		slog.Info("Rejected GitHub webhook", "reason", err.Error())
+		writeProblem(rw, r, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+	switch name := r.Header.Get(gitHubEventHeader); name {
+	case events.GitHubEventPackage, events.GitHubEventRegistryPackage:
+	case events.GitHubEventPing:
+		writeWebhookResult(rw, r, webhookResult{Status: "accepted"}, nil)
+		return
+	default:
+		writeWebhookResult(rw, r, webhookResult{Status: "ignored", Reason: "unsupported event " + name}, nil)
+		return
+	}
+	var event events.GitHubPackageEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	deliveryID := r.Header.Get(gitHubDeliveryHeader)
+	if reason := event.IgnoreReason(); reason != "" {
+		slog.Info("Ignoring GitHub event", "delivery-id", deliveryID, "reason", reason)
+		writeWebhookResult(rw, r, webhookResult{Status: "ignored", Reason: reason}, nil)
+		return
+	}
+	result, err := w.handleImageEvent(secrets.Client{Name: gitHubCaller}, event.ImageEvent(deliveryID))
+	writeWebhookResult(rw, r, result, err)
+}
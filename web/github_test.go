@@ -0,0 +1,96 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/image_watcher"
+)
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	// example from the GitHub webhook documentation
+	secret := []byte("It's a Secret to Everybody")
+	body := []byte("Hello, World!")
+	valid := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+
+	if err := verifyGitHubSignature(secret, body, valid); err != nil {
+		t.Fatalf("Expected documented signature to verify, got %v", err)
+	}
+	tests := map[string]error{
+		"": ErrMissingSignature,
+		"757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17": ErrInvalidSignature,
+		"sha256=not-hex": ErrInvalidSignature,
+		"sha256=0000000000000000000000000000000000000000000000000000000000000000": ErrInvalidSignature,
+	}
+	for header, expected := range tests {
+		if err := verifyGitHubSignature(secret, body, header); !errors.Is(err, expected) {
+			t.Errorf("verifyGitHubSignature(%q) = %v, expected %v", header, err, expected)
+		}
+	}
+	if err := verifyGitHubSignature(secret, []byte("Hello, World?"), valid); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected modified body to be rejected, got %v", err)
+	}
+}
+
+func TestHandleGitHub(t *testing.T) {
+	secret := []byte("github-secret")
+	w := newTestWeb(map[string]map[string]image_watcher.Image{
+		"/acme/app": {"v": {RepositoryName: "/acme/app", ImageTag: "v1", Registry: events.RegistryGhcr}},
+	}, nil, func(w *Web) {
+		w.gitHubSecret = secret
+	})
+	send := func(event, signature, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/github", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(gitHubEventHeader, event)
+		r.Header.Set(gitHubDeliveryHeader, "delivery-1")
+		if signature != "" {
+			r.Header.Set(gitHubSignatureHeader, signature)
+		}
+		rec := httptest.NewRecorder()
+		w.mux.ServeHTTP(rec, r)
+		return rec
+	}
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	published := `{"action":"published","package":{"name":"App","package_type":"CONTAINER","owner":{"login":"Acme"},` +
+		`"package_version":{"version":"sha256:abc","container_metadata":{"tag":{"name":"v2","digest":"sha256:abc"}}}}}`
+
+	if rec := send(events.GitHubEventPackage, "", published); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unsigned event to be rejected, got %d", rec.Code)
+	}
+	if rec := send(events.GitHubEventPackage, sign("other"), published); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrongly signed event to be rejected, got %d", rec.Code)
+	}
+
+	ping := `{"zen":"Keep it logically awesome.","hook_id":1}`
+	rec := send(events.GitHubEventPing, sign(ping), ping)
+	if result := decodeResult(t, rec); rec.Code != http.StatusOK || result.Status != "accepted" {
+		t.Errorf("Expected ping to be accepted, got %d %+v", rec.Code, result)
+	}
+	push := `{"ref":"refs/heads/main"}`
+	rec = send("push", sign(push), push)
+	if result := decodeResult(t, rec); rec.Code != http.StatusOK || result.Status != "ignored" {
+		t.Errorf("Expected an unsupported event to be ignored, got %d %+v", rec.Code, result)
+	}
+
+	rec = send(events.GitHubEventPackage, sign(published), published)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the package to be queued, got %d %s", rec.Code, rec.Body)
+	}
+	result := decodeResult(t, rec)
+	record, ok := w.history.Get(result.DeploymentIDs[0])
+	if !ok || record.Repository != "/acme/app" || record.Tag != "v2" || record.EventID != "delivery-1" || record.Caller != gitHubCaller {
+		t.Errorf("Unexpected deployment %+v", record)
+	}
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+const (
+	signatureHeader = "X-Signature"
+	timestampHeader = "X-Signature-Timestamp"
+	nonceHeader     = "X-Signature-Nonce"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing signature headers")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrStaleTimestamp   = errors.New("signature timestamp outside allowed skew")
+	ErrReplayedNonce    = errors.New("nonce already used")
+)
+
+type signatureValidator interface {
+	AuthenticateSignature(message, signature []byte) (secrets.Client, bool)
+}
+
+// hmacVerifier checks requests signed as
+// HMAC-SHA256(key, timestamp + "." + nonce + "." + body), where timestamp is
+// in unix seconds and the signature is sent hex encoded, optionally prefixed
+// with "sha256=".
+type hmacVerifier struct {
+	validator signatureValidator
+	skew      time.Duration
+	nonces    *nonceCache
+	now       func() time.Time
+}
+
+func newHmacVerifier(validator signatureValidator, skew time.Duration) *hmacVerifier {
+	return &hmacVerifier{
+		validator: validator,
+		skew:      skew,
+		nonces:    newNonceCache(),
+		now:       time.Now,
+	}
+}
+
+func signedMessage(timestamp, nonce string, body []byte) []byte {
+	message := make([]byte, 0, len(timestamp)+len(nonce)+len(body)+2)
+	message = append(message, timestamp...)
+	message = append(message, '.')
+	message = append(message, nonce...)
+	message = append(message, '.')
+	return append(message, body...)
+}
+
+// verify returns the client whose key signed the request.
+func (v *hmacVerifier) verify(r *http.Request, body []byte) (secrets.Client, error) {
+	signature := r.Header.Get(signatureHeader)
+	timestamp := r.Header.Get(timestampHeader)
+	nonce := r.Header.Get(nonceHeader)
+	if signature == "" || timestamp == "" || nonce == "" {
+		return secrets.Client{}, ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return secrets.Client{}, ErrMissingSignature
+	}
+	now := v.now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.skew)) || signedAt.After(now.Add(v.skew)) {
+		return secrets.Client{}, ErrStaleTimestamp
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return secrets.Client{}, ErrInvalidSignature
+	}
+	client, ok := v.validator.AuthenticateSignature(signedMessage(timestamp, nonce, body), decoded)
+	if !ok {
+		return secrets.Client{}, ErrInvalidSignature
+	}
+
+	// only remember nonces of valid signatures so unauthenticated callers
+	// cannot fill the cache, and keep them until the timestamp can no longer
+	// pass the skew check
+	if !v.nonces.add(nonce, signedAt.Add(v.skew), now) {
+		return secrets.Client{}, ErrReplayedNonce
+	}
+	return client, nil
+}
+
+type nonceCache struct {
+	seen  map[string]time.Time
+	mutex sync.Mutex
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// add stores nonce until expires and reports false if it was already present.
+func (n *nonceCache) add(nonce string, expires, now time.Time) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for key, expiry := range n.seen {
+		if now.After(expiry) {
+			delete(n.seen, key)
+		}
+	}
+	if _, ok := n.seen[nonce]; ok {
+		return false
+	}
+	n.seen[nonce] = expires
+	return true
+}
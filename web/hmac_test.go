@@ -0,0 +1,82 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+type keyValidator struct {
+	key []byte
+}
+
+func (k keyValidator) AuthenticateSignature(message, signature []byte) (secrets.Client, bool) {
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write(message)
+	return secrets.Client{Name: secrets.DefaultClient}, hmac.Equal(signature, mac.Sum(nil))
+}
+
+func signRequest(key []byte, timestamp time.Time, nonce string, body []byte) map[string]string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signedMessage(ts, nonce, body))
+	return map[string]string{
+		signatureHeader: "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+		timestampHeader: ts,
+		nonceHeader:     nonce,
+	}
+}
+
+func TestHmacVerify(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1720000000, 0)
+	v := newHmacVerifier(keyValidator{key}, 5*time.Minute)
+	v.now = func() time.Time { return now }
+	body := []byte(`{"detail":{}}`)
+
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		body    []byte
+		err     error
+	}{
+		{"valid", signRequest(key, now, "n1", body), body, nil},
+		{"replayed nonce", signRequest(key, now, "n1", body), body, ErrReplayedNonce},
+		{"tampered body", signRequest(key, now, "n2", body), []byte(`{}`), ErrInvalidSignature},
+		{"wrong key", signRequest([]byte("other"), now, "n3", body), body, ErrInvalidSignature},
+		{"old timestamp", signRequest(key, now.Add(-10*time.Minute), "n4", body), body, ErrStaleTimestamp},
+		{"future timestamp", signRequest(key, now.Add(10*time.Minute), "n5", body), body, ErrStaleTimestamp},
+		{"missing headers", map[string]string{}, body, ErrMissingSignature},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest("POST", "/update", nil)
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		_, err := v.verify(r, tc.body)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestNonceCacheExpiry(t *testing.T) {
+	n := newNonceCache()
+	now := time.Now()
+	if !n.add("a", now.Add(time.Minute), now) {
+		t.Fatalf("Expected first use of nonce to be accepted")
+	}
+	if n.add("a", now.Add(time.Minute), now) {
+		t.Fatalf("Expected second use of nonce to be rejected")
+	}
+	if !n.add("a", now.Add(3*time.Minute), now.Add(2*time.Minute)) {
+		t.Fatalf("Expected nonce to be accepted after it expired")
+	}
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"ljos.app/ecr-change-receiver/deployment"
+)
+
+func (w *Web) listImages(rw http.ResponseWriter, r *http.Request) {
+	if _, ok := w.authorizeAdmin(rw, r); !ok {
+		return
+	}
+	writeJSON(rw, http.StatusOK, w.imageWatcher.ImageStatuses(r.Context()))
+}
+
+// rollbackImage redeploys the previous tag of a watched image. Repository
+// names containing slashes must be sent URL encoded. The prefix is left out
+// of the path for images watched with an empty prefix.
+func (w *Web) rollbackImage(rw http.ResponseWriter, r *http.Request) {
+	caller, ok := w.authorizeAdmin(rw, r)
+	if !ok {
+		return
+	}
+	repository, prefix := "/"+r.PathValue("repo"), r.PathValue("prefix")
+	image, ok := w.imageWatcher.GetImage(repository, prefix)
+	if !ok {
+		writeProblem(rw, r, http.StatusNotFound, CodeNotFound, "image is not watched")
+		return
+	}
+	if image.PreviousImageTag == "" {
+		writeProblem(rw, r, http.StatusConflict, CodeConflict, "no previous image tag to roll back to")
+		return
+	}
+	if !checkAllowed(rw, r, caller, repository, image.PreviousImageTag) {
+		return
+	}
+	w.queueManualDeployment(rw, r, caller.Name, deployment.TriggerRollback, repository, prefix, image.PreviousImageTag)
+}
+
+// deployImage deploys the tag given in the query to a watched image.
+func (w *Web) deployImage(rw http.ResponseWriter, r *http.Request) {
+	caller, ok := w.authorizeAdmin(rw, r)
+	if !ok {
+		return
+	}
+	repository, prefix := "/"+r.PathValue("repo"), r.PathValue("prefix")
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidRequest, "missing tag query parameter")
+		return
+	}
+	if !strings.HasPrefix(tag, prefix) {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidRequest, "tag does not match the image tag prefix")
+		return
+	}
+	if _, ok := w.imageWatcher.GetImage(repository, prefix); !ok {
+		writeProblem(rw, r, http.StatusNotFound, CodeNotFound, "image is not watched")
+		return
+	}
+	if !checkAllowed(rw, r, caller, repository, tag) {
+		return
+	}
+	w.queueManualDeployment(rw, r, caller.Name, deployment.TriggerManual, repository, prefix, tag)
+}
+
+func (w *Web) queueManualDeployment(rw http.ResponseWriter, r *http.Request, caller string, trigger deployment.Trigger, repository, prefix, tag string) {
+	d := deployment.New(trigger, repository, tag)
+	d.ImageTagPrefix = prefix
+	d.Caller = caller
+	if err := w.enqueue(d); err != nil {
+		writeProblem(rw, r, http.StatusServiceUnavailable, CodeQueueUnavailable, err.Error())
+		return
+	}
+	writeJSON(rw, http.StatusAccepted, webhookResult{
+		Status:        string(deployment.StatusQueued),
+		DeploymentIDs: []string{d.ID},
+	})
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/image_watcher"
+)
+
+func TestManualDeployments(t *testing.T) {
+	w := newTestWeb(map[string]map[string]image_watcher.Image{
+		"/image1": {
+			"staging": {RepositoryName: "/image1", ImageTag: "staging-2", PreviousImageTag: "staging-1", Registry: events.RegistryEcr},
+			"prod":    {RepositoryName: "/image1", ImageTag: "prod-1", Registry: events.RegistryEcr},
+		},
+		"/team/app": {"": {RepositoryName: "/team/app", ImageTag: "v2", PreviousImageTag: "v1", Registry: events.RegistryEcr}},
+	}, []MtlsCaller{{Name: "admin", Identities: []string{"admin"}}}, nil)
+
+	testCases := []struct {
+		name   string
+		target string
+		code   int
+		tag    string
+		prefix string
+	}{
+		{"rollback unwatched", "/images/image2/staging/rollback", http.StatusNotFound, "", ""},
+		{"rollback without previous tag", "/images/image1/prod/rollback", http.StatusConflict, "", ""},
+		{"rollback", "/images/image1/staging/rollback", http.StatusAccepted, "staging-1", "staging"},
+		{"deploy unwatched", "/images/image1/dev/deploy?tag=dev-1", http.StatusNotFound, "", ""},
+		{"deploy tag without prefix", "/images/image1/staging/deploy?tag=prod-2", http.StatusBadRequest, "", ""},
+		{"deploy without tag", "/images/image1/staging/deploy", http.StatusBadRequest, "", ""},
+		{"deploy", "/images/image1/prod/deploy?tag=prod-2", http.StatusAccepted, "prod-2", "prod"},
+		{"rollback empty prefix", "/images/team%2Fapp/rollback", http.StatusAccepted, "v1", ""},
+		{"deploy empty prefix", "/images/team%2Fapp/deploy?tag=v3", http.StatusAccepted, "v3", ""},
+	}
+	for _, tc := range testCases {
+		rec := serve(w, http.MethodPost, tc.target, "admin", "")
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.code, rec.Code, rec.Body)
+			continue
+		}
+		if tc.code != http.StatusAccepted {
+			continue
+		}
+		result := decodeResult(t, rec)
+		if len(result.DeploymentIDs) != 1 {
+			t.Fatalf("%s: expected one deployment, got %+v", tc.name, result)
+		}
+		record, ok := w.history.Get(result.DeploymentIDs[0])
+		if !ok || record.Tag != tc.tag || record.ImageTagPrefix != tc.prefix {
+			t.Errorf("%s: expected %s queued for prefix %q, got %+v", tc.name, tc.tag, tc.prefix, record)
+		}
+	}
+
+	if rec := serve(w, http.MethodPost, "/images/image1/staging/rollback", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a request without client certificate to be rejected, got %d", rec.Code)
+	}
+}
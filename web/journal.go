@@ -0,0 +1,131 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"ljos.app/ecr-change-receiver/deployment"
+	"ljos.app/ecr-change-receiver/journal"
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+// replayCaller prefixes the original caller of replayed events.
+const replayCaller = "replay:"
+
+// deploymentSource is the source of entries recording how a deployment ended.
+const deploymentSource = "deployment"
+
+type journalEntryKey struct{}
+
+// journaled records every request to next in the journal once it has been
+// answered. Handlers fill in the entry through journalAuth, writeProblem and
+// writeWebhookResult.
+func (w *Web) journaled(source string, next http.HandlerFunc) http.HandlerFunc {
+	if w.journal == nil {
+		return next
+	}
+	return func(rw http.ResponseWriter, r *http.Request) {
+		entry := &journal.Entry{ReceivedAt: time.Now().UTC(), Source: source, SourceIP: clientAddr(r)}
+		next(rw, r.WithContext(context.WithValue(r.Context(), journalEntryKey{}, entry)))
+		w.appendJournal(*entry)
+	}
+}
+
+// journalEntry returns the entry of a journaled request, or nil.
+func journalEntry(r *http.Request) *journal.Entry {
+	entry, _ := r.Context().Value(journalEntryKey{}).(*journal.Entry)
+	return entry
+}
+
+// journalAuth records the authentication result of a request.
+func journalAuth(r *http.Request, caller string, err error) {
+	entry := journalEntry(r)
+	if entry == nil {
+		return
+	}
+	entry.Caller = caller
+	entry.Auth = "ok"
+	if err != nil {
+		entry.Auth = err.Error()
+	}
+}
+
+// journalResult records the outcome of an event. Failed events keep their
+// event, so they can be replayed.
+func journalResult(entry *journal.Entry, result webhookResult, err error) {
+	entry.DeploymentIDs = result.DeploymentIDs
+	entry.Event = result.event
+	if err != nil {
+		entry.Outcome, entry.Reason = journal.OutcomeFailed, err.Error()
+		return
+	}
+	entry.Outcome, entry.Reason = result.Status, result.Reason
+}
+
+// journalDeployment records how d ended, so the journal tells which
+// deployments went live after the deployment history is gone.
+func (w *Web) journalDeployment(d *deployment.Deployment, err error) {
+	if w.replaying {
+		return
+	}
+	entry := journal.Entry{
+		ReceivedAt:    time.Now().UTC(),
+		Source:        deploymentSource,
+		Caller:        d.Caller,
+		Outcome:       string(deployment.StatusSucceeded),
+		DeploymentIDs: []string{d.ID},
+	}
+	if err != nil {
+		entry.Outcome, entry.Reason = string(deployment.StatusFailed), err.Error()
+	}
+	w.appendJournal(entry)
+}
+
+func (w *Web) appendJournal(entry journal.Entry) {
+	if w.journal == nil {
+		return
+	}
+	if err := w.journal.Append(entry); err != nil {
+		slog.Error("Failed to write journal entry", "source", entry.Source, "error", err)
+	}
+}
+
+// Replay runs the events of entries through the deployment pipeline in
+// journal order, waits for the deployments to finish and closes the
+// services. Events wait for room in the deployment queue rather than being
+// dropped when it is full. It must not run next to a receiver that manages the same
+// containers. The resulting deployments are written to out as JSON lines.
+func (w *Web) Replay(entries []journal.Entry, out io.Writer) error {
+	w.imageWatcher.Start()
+	w.queue.Start()
+	defer w.Close()
+	w.replaying = true
+	var errs []error
+	for _, entry := range entries {
+		if entry.Event == nil {
+			slog.Info("Skipping journal entry without event", "received-at", entry.ReceivedAt, "outcome", entry.Outcome)
+			continue
+		}
+		result, err := w.handleImageEvent(secrets.Client{Name: replayCaller + entry.Caller}, *entry.Event)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Info("Replayed event", "received-at", entry.ReceivedAt, "event-id", entry.Event.ID, "status", result.Status)
+	}
+	w.queue.Close()
+
+	records := w.history.List()
+	encoder := json.NewEncoder(out)
+	for i := len(records) - 1; i >= 0; i-- {
+		if err := encoder.Encode(records[i]); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ljos.app/ecr-change-receiver/deployment"
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/journal"
+)
+
+func TestJournaledRecordsOutcome(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	config := journal.Config{Path: path}
+	config.SetDefaults()
+	j, err := journal.Open(config)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	w := &Web{journal: j}
+
+	rejected := w.journaled(RouteUpdate, func(rw http.ResponseWriter, r *http.Request) {
+		journalAuth(r, "", ErrInvalidToken)
+		writeProblem(rw, r, http.StatusUnauthorized, CodeUnauthorized, ErrInvalidToken.Error())
+	})
+	queued := w.journaled(RouteUpdate, func(rw http.ResponseWriter, r *http.Request) {
+		journalAuth(r, webhookCaller, nil)
+		event := events.ImageEvent{ID: "event-1", Registry: events.RegistryEcr, Action: events.ActionPush, Repository: "image1", Tag: "v1"}
+		writeWebhookResult(rw, r, webhookResult{Status: "queued", DeploymentIDs: []string{"d1"}, event: &event}, nil)
+	})
+	failed := w.journaled(RouteUpdate, func(rw http.ResponseWriter, r *http.Request) {
+		event := events.ImageEvent{ID: "event-2", Registry: events.RegistryEcr, Action: events.ActionPush, Repository: "image1", Tag: "v2"}
+		writeWebhookResult(rw, r, webhookResult{Status: "queued", event: &event}, errors.New("queue is full"))
+	})
+	for _, handler := range []http.HandlerFunc{rejected, queued, failed} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/update", nil))
+	}
+	j.Close()
+
+	entries, err := journal.ReadFiles([]string{path}, journal.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if e := entries[0]; e.Outcome != journal.OutcomeRejected || e.Auth != ErrInvalidToken.Error() || e.Event != nil {
+		t.Errorf("Unexpected rejected entry %+v", e)
+	}
+	if e := entries[1]; e.Outcome != "queued" || e.Auth != "ok" || e.Caller != webhookCaller || e.Event == nil || e.Event.ID != "event-1" {
+		t.Errorf("Unexpected queued entry %+v", e)
+	}
+	if e := entries[2]; e.Outcome != journal.OutcomeFailed || e.Reason != "queue is full" || e.Event == nil || e.Event.ID != "event-2" {
+		t.Errorf("Unexpected failed entry %+v", e)
+	}
+	for _, e := range entries {
+		if e.Source != RouteUpdate || e.ReceivedAt.IsZero() {
+			t.Errorf("Expected source and receive time to be recorded, got %+v", e)
+		}
+	}
+}
+
+func TestJournalDeploymentRecordsFinalStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	config := journal.Config{Path: path}
+	config.SetDefaults()
+	j, err := journal.Open(config)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	w := &Web{journal: j}
+	succeeded := deployment.New(deployment.TriggerWebhook, "/image1", "v1")
+	succeeded.Caller = webhookCaller
+	failed := deployment.New(deployment.TriggerWebhook, "/image1", "v2")
+	w.journalDeployment(succeeded, nil)
+	w.journalDeployment(failed, errors.New("failed to pull image"))
+	w.replaying = true
+	w.journalDeployment(deployment.New(deployment.TriggerWebhook, "/image1", "v3"), nil)
+	j.Close()
+
+	entries, err := journal.ReadFiles([]string{path}, journal.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, replayed deployments excluded, got %d", len(entries))
+	}
+	if e := entries[0]; e.Source != deploymentSource || e.Outcome != string(deployment.StatusSucceeded) || e.Caller != webhookCaller || len(e.DeploymentIDs) != 1 || e.DeploymentIDs[0] != succeeded.ID {
+		t.Errorf("Unexpected succeeded entry %+v", e)
+	}
+	if e := entries[1]; e.Outcome != string(deployment.StatusFailed) || e.Reason != "failed to pull image" || e.DeploymentIDs[0] != failed.ID {
+		t.Errorf("Unexpected failed entry %+v", e)
+	}
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+var (
+	ErrMissingClientCertificate = errors.New("missing client certificate")
+	ErrUnknownClient            = errors.New("client certificate identity is not allowed")
+)
+
+// mtlsAuthenticator maps the identities of client certificates, which the TLS
+// listener already verified against the client CA, to callers.
+type mtlsAuthenticator struct {
+	callers map[string]secrets.Client
+}
+
+func newMtlsAuthenticator(callers []MtlsCaller) *mtlsAuthenticator {
+	m := &mtlsAuthenticator{callers: make(map[string]secrets.Client)}
+	for _, caller := range callers {
+		client := secrets.Client{Name: caller.Name, Repositories: caller.Repositories, TagPrefixes: caller.TagPrefixes}
+		for _, identity := range caller.Identities {
+			m.callers[identity] = client
+		}
+	}
+	return m
+}
+
+// certificateIdentities returns the subject common name and the DNS, URI and
+// email subject alternative names of cert.
+func certificateIdentities(cert *x509.Certificate) []string {
+	identities := []string{}
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return append(identities, cert.EmailAddresses...)
+}
+
+func (m *mtlsAuthenticator) authenticate(r *http.Request) (secrets.Client, error) {
+	// VerifiedChains is only set once the certificate chained to a client CA
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return secrets.Client{}, ErrMissingClientCertificate
+	}
+	for _, identity := range certificateIdentities(r.TLS.PeerCertificates[0]) {
+		if caller, ok := m.callers[identity]; ok {
+			return caller, nil
+		}
+	}
+	return secrets.Client{}, ErrUnknownClient
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
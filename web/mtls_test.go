@@ -0,0 +1,53 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMtlsAuthenticate(t *testing.T) {
+	m := newMtlsAuthenticator([]MtlsCaller{
+		{Name: "relay", Identities: []string{"relay.internal", "spiffe://example.org/relay"}},
+		{Name: "ci", Identities: []string{"ci-runner"}},
+	})
+	spiffe, _ := url.Parse("spiffe://example.org/relay")
+
+	testCases := []struct {
+		name   string
+		cert   *x509.Certificate
+		caller string
+		err    error
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "ci-runner"}}, "ci", nil},
+		{"dns san", &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"relay.internal"}}, "relay", nil},
+		{"uri san", &x509.Certificate{URIs: []*url.URL{spiffe}}, "relay", nil},
+		{"unknown", &x509.Certificate{Subject: pkix.Name{CommonName: "someone"}}, "", ErrUnknownClient},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest("POST", "/update", nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{tc.cert},
+			VerifiedChains:   [][]*x509.Certificate{{tc.cert}},
+		}
+		caller, err := m.authenticate(r)
+		if !errors.Is(err, tc.err) || caller.Name != tc.caller {
+			t.Errorf("%s: expected %q %v, got %q %v", tc.name, tc.caller, tc.err, caller.Name, err)
+		}
+	}
+
+	unverified := httptest.NewRequest("POST", "/update", nil)
+	unverified.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ci-runner"}}},
+	}
+	if _, err := m.authenticate(unverified); !errors.Is(err, ErrMissingClientCertificate) {
+		t.Errorf("Expected unverified certificate to be rejected, got %v", err)
+	}
+	if _, err := m.authenticate(httptest.NewRequest("POST", "/update", nil)); !errors.Is(err, ErrMissingClientCertificate) {
+		t.Errorf("Expected plain HTTP request to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"ljos.app/ecr-change-receiver/journal"
+)
+
+// Machine readable problem codes returned in the "code" member of
+// application/problem+json responses.
+const (
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeInvalidBody          = "invalid_body"
+	CodeUnknownField         = "unknown_field"
+	CodeInvalidRequest       = "invalid_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeRateLimited          = "rate_limited"
+	CodeConflict             = "conflict"
+	CodeQueueUnavailable     = "queue_unavailable"
+	CodeSubscriptionFailed   = "subscription_failed"
+)
+
+// problem is an RFC 9457 problem details object.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func writeProblem(rw http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	if entry := journalEntry(r); entry != nil && entry.Outcome == "" {
+		entry.Outcome, entry.Reason = journal.OutcomeRejected, code+": "+detail
+	}
+	rw.Header().Set("Content-Type", "application/problem+json")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(status)
+	err := json.NewEncoder(rw).Encode(problem{
+		Type:     "urn:ecr-change-receiver:problem:" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Code:     code,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+	if err != nil {
+		slog.Error("Failed to write problem response", "error", err)
+	}
+}
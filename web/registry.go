@@ -0,0 +1,75 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"ljos.app/ecr-change-receiver/deployment"
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/secrets"
+)
+
+// handleRegistry receives notifications from a CNCF distribution (Docker
+// Registry v2) server. The registry sends the configured auth headers with
+// every notification, so the auth mode applies as for /update.
+func (w *Web) handleRegistry(rw http.ResponseWriter, r *http.Request) {
+	if w.ratelimiter.RateLimitsExceeded(clientAddr(r)) {
+		writeProblem(rw, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+		return
+	}
+	if !requireJSON(rw, r) {
+		return
+	}
+	body, ok := readBody(rw, r, w.config.MaxBodyBytes[RouteRegistry])
+	if !ok {
+		return
+	}
+	caller, err := w.authorizeRequest(r, body)
+	journalAuth(r, caller.Name, err)
+	if err != nil {
+		w.writeUnauthorized(rw, r, err)
+		return
+	}
+	// the event fields differ between registry versions, so unknown fields
+	// are accepted here
+	var envelope events.DistributionEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	result, err := w.handleDistributionEvents(caller, envelope)
+	writeWebhookResult(rw, r, result, err)
+}
+
+// handleDistributionEvents runs each tagged push of envelope that caller may
+// deploy through handleImageEvent. A registry notifies about every
+// repository, so pushes the caller may not deploy are ignored rather than
+// refused. The registry retries the whole envelope when any event fails, and
+// deduplication keeps the others from deploying twice.
+func (w *Web) handleDistributionEvents(caller secrets.Client, envelope events.DistributionEnvelope) (webhookResult, error) {
+	combined := webhookResult{Status: "ignored", Reason: "no tagged pushes"}
+	for _, event := range envelope.Events {
+		if reason := event.IgnoreReason(); reason != "" {
+			slog.Debug("Ignoring registry event", "caller", caller.Name, "event-id", event.ID, "reason", reason)
+			continue
+		}
+		if !caller.Allows(event.Target.Repository, event.Target.Tag) {
+			slog.Info("Ignoring registry event not allowed for caller", "caller", caller.Name, "event-id", event.ID,
+				"repository", event.Target.Repository, "image-tag", event.Target.Tag)
+			continue
+		}
+		result, err := w.handleImageEvent(caller, event.ImageEvent())
+		if err != nil {
+			return result, err
+		}
+		combined.DeploymentIDs = append(combined.DeploymentIDs, result.DeploymentIDs...)
+		switch {
+		case result.Status == string(deployment.StatusQueued):
+			combined.Status, combined.Reason = result.Status, ""
+		case combined.Status == "ignored":
+			combined.Status, combined.Reason = result.Status, result.Reason
+		}
+	}
+	return combined, nil
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// route registers handler for method and path, and answers other methods
+// on path with a 405 problem.
+func (w *Web) route(method string, path string, handler http.HandlerFunc) {
+	w.mux.HandleFunc(method+" "+path, handler)
+	w.mux.HandleFunc(path, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Allow", method)
+		writeProblem(rw, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+			fmt.Sprintf("%s is not allowed, use %s", r.Method, method))
+	})
+}
+
+// requireJSON rejects requests whose Content-Type is not JSON.
+func requireJSON(rw http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return true
+	}
+	writeProblem(rw, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be application/json")
+	return false
+}
+
+// readBody reads at most limit bytes of the request body.
+func readBody(rw http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(rw, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", limit))
+			return nil, false
+		}
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidBody, "failed to read request body")
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeStrict decodes a single JSON value from body into v, rejecting
+// unknown fields and trailing data.
+func decodeStrict(rw http.ResponseWriter, r *http.Request, body []byte, v any) bool {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = errors.New("unexpected data after JSON value")
+		}
+	}
+	if err != nil {
+		code := CodeInvalidBody
+		if strings.HasPrefix(err.Error(), "json: unknown field") {
+			code = CodeUnknownField
+		}
+		writeProblem(rw, r, http.StatusBadRequest, code, err.Error())
+		return false
+	}
+	return true
+}
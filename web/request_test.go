@@ -0,0 +1,106 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problem {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Fatalf("Expected problem content type, got %q", got)
+	}
+	var p problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	return p
+}
+
+func TestRouteRejectsOtherMethods(t *testing.T) {
+	w := &Web{mux: http.NewServeMux()}
+	w.route(http.MethodPost, "/update", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	})
+
+	rec := httptest.NewRecorder()
+	w.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected POST to reach handler, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/update", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Allow"); got != http.MethodPost {
+		t.Errorf("Expected Allow POST, got %q", got)
+	}
+	if p := decodeProblem(t, rec); p.Code != CodeMethodNotAllowed {
+		t.Errorf("Expected code %s, got %s", CodeMethodNotAllowed, p.Code)
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	for contentType, ok := range map[string]bool{
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/cloudevents+json":    true,
+		"text/plain":                      false,
+		"":                                false,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/update", nil)
+		r.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		if got := requireJSON(rec, r); got != ok {
+			t.Errorf("requireJSON(%q) = %v, expected %v", contentType, got, ok)
+		}
+		if !ok && rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected 415 for %q, got %d", contentType, rec.Code)
+		}
+	}
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(strings.Repeat("a", 11)))
+	rec := httptest.NewRecorder()
+	if _, ok := readBody(rec, r, 10); ok {
+		t.Fatalf("Expected body over the limit to be rejected")
+	}
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413, got %d", rec.Code)
+	}
+	if p := decodeProblem(t, rec); p.Code != CodeBodyTooLarge {
+		t.Errorf("Expected code %s, got %s", CodeBodyTooLarge, p.Code)
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	tests := map[string]string{
+		`{"name":"a"}`:              "",
+		`{"name":"a","extra":true}`: CodeUnknownField,
+		`{"name":"a"}{}`:            CodeInvalidBody,
+		`{"name":`:                  CodeInvalidBody,
+	}
+	for body, code := range tests {
+		rec := httptest.NewRecorder()
+		var v payload
+		ok := decodeStrict(rec, httptest.NewRequest(http.MethodPost, "/", nil), []byte(body), &v)
+		if ok != (code == "") {
+			t.Errorf("decodeStrict(%s) = %v", body, ok)
+			continue
+		}
+		if code != "" {
+			if p := decodeProblem(t, rec); p.Code != code {
+				t.Errorf("decodeStrict(%s) code = %s, expected %s", body, p.Code, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/secrets"
+	"ljos.app/ecr-change-receiver/sns"
+)
+
+// handleSNS receives messages of an SNS HTTP(S) subscription. Subscriptions
+// to allowed topics are confirmed and notifications carrying ECR events go
+// through handleWebhook. SNS authenticates with the message signature, so
+// the configured auth mode does not apply.
+func (w *Web) handleSNS(rw http.ResponseWriter, r *http.Request) {
+	if w.ratelimiter.RateLimitsExceeded(clientAddr(r)) {
+		writeProblem(rw, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+		return
+	}
+	// SNS posts JSON as text/plain, so the content type is not checked
+	body, ok := readBody(rw, r, w.config.MaxBodyBytes[RouteSNS])
+	if !ok {
+		return
+	}
+	var message sns.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	if header := r.Header.Get(sns.MessageTypeHeader); header != "" && header != message.Type {
+		writeProblem(rw, r, http.StatusBadRequest, CodeInvalidRequest, "message type does not match "+sns.MessageTypeHeader)
+		return
+	}
+	log := slog.With("topic-arn", message.TopicArn, "message-id", message.MessageID, "type", message.Type)
+	err := w.snsVerifier.Verify(r.Context(), message)
+	journalAuth(r, "sns:"+message.TopicArn, err)
+	if err != nil {
+		log.Info("Rejected SNS message", "reason", err.Error())
+		writeProblem(rw, r, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+
+	switch message.Type {
+	case sns.TypeSubscriptionConfirmation:
+		if err := w.snsVerifier.Confirm(r.Context(), message); err != nil {
+			log.Error("Failed to confirm SNS subscription", "error", err)
+			writeProblem(rw, r, http.StatusBadGateway, CodeSubscriptionFailed, err.Error())
+			return
+		}
+		log.Info("Confirmed SNS subscription")
+		writeWebhookResult(rw, r, webhookResult{Status: "confirmed"}, nil)
+	case sns.TypeUnsubscribeConfirmation:
+		log.Warn("SNS subscription was removed, resubscribe to keep receiving events")
+		writeWebhookResult(rw, r, webhookResult{Status: "accepted"}, nil)
+	default:
+		var event events.EcrEvent
+		if !decodeStrict(rw, r, []byte(message.Message), &event) {
+			return
+		}
+		result, err := w.handleWebhook(secrets.Client{Name: "sns:" + message.TopicArn}, event)
+		writeWebhookResult(rw, r, result, err)
+	}
+}
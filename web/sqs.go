@@ -0,0 +1,45 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/journal"
+	"ljos.app/ecr-change-receiver/secrets"
+	"ljos.app/ecr-change-receiver/sqs_listener"
+)
+
+// sqsCaller names the caller of events received from queueURL.
+func sqsCaller(queueURL string) string {
+	name := queueURL
+	if u, err := url.Parse(queueURL); err == nil {
+		name = path.Base(u.Path)
+	}
+	return "sqs:" + name
+}
+
+// handleSQSMessage runs an EventBridge event received from SQS through
+// handleWebhook. It returns once the deployment is recorded, so the message
+// is only deleted after that.
+func (w *Web) handleSQSMessage(caller string) sqs_listener.Handler {
+	return func(ctx context.Context, body []byte) error {
+		entry := journal.Entry{ReceivedAt: time.Now().UTC(), Source: "sqs", Caller: caller}
+		defer func() { w.appendJournal(entry) }()
+		var event events.EcrEvent
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&event); err != nil {
+			entry.Outcome, entry.Reason = journal.OutcomeRejected, err.Error()
+			return fmt.Errorf("%w: %v", sqs_listener.ErrPoison, err)
+		}
+		result, err := w.handleWebhook(secrets.Client{Name: caller}, event)
+		journalResult(&entry, result, err)
+		return err
+	}
+}
@@ -1,117 +1,495 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"slices"
+	"time"
 
 	"ljos.app/ecr-change-receiver/aws"
+	"ljos.app/ecr-change-receiver/dedup"
+	"ljos.app/ecr-change-receiver/deployment"
+	"ljos.app/ecr-change-receiver/events"
 	image_watcher "ljos.app/ecr-change-receiver/image_watcher"
+	"ljos.app/ecr-change-receiver/journal"
 	"ljos.app/ecr-change-receiver/ratelimit"
 	secrets "ljos.app/ecr-change-receiver/secrets"
+	"ljos.app/ecr-change-receiver/sns"
+	"ljos.app/ecr-change-receiver/sqs_listener"
 )
 
-type MyEvent struct {
-	Time   string `json:"time"`
-	Detail struct {
-		Result         string `json:"result"`
-		RepositoryName string `json:"repository-name"`
-		ImageTag       string `json:"image-tag"`
-	} `json:"detail"`
-}
-
 type Web struct {
+	config        *Config
+	mux           *http.ServeMux
+	server        *http.Server
 	secretmanager *secrets.SecretService
 	imageWatcher  *image_watcher.ImageWatcher
+	queue         *deployment.Queue
+	history       *deployment.Store
+	dedup         *dedup.Deduplicator
+	ratelimiter   *ratelimit.RateLimiter
+	hmacVerifier  *hmacVerifier
+	// mtlsAuthenticator maps verified client certificates to callers
+	mtlsAuthenticator *mtlsAuthenticator
+	clientIPs         *clientIPResolver
+	// snsVerifier is nil unless SNS topics are configured
+	snsVerifier *sns.Verifier
+	// sqsListener is nil unless an SQS queue is configured
+	sqsListener *sqs_listener.Listener
+	// poller is nil unless ECR polling is configured
+	poller *image_watcher.Poller
+	// journal is nil unless a journal path is configured
+	journal *journal.Journal
+	// replaying is set by Replay. Deployments then wait for room in the queue
+	// instead of dropping events, and their outcome is not journaled again.
+	replaying bool
+	// dockerHubToken and gitHubSecret are nil unless their adapter is enabled
+	dockerHubToken   []byte
+	gitHubSecret     []byte
+	webhookAllowlist []netip.Prefix
+	adminAllowlist   []netip.Prefix
 }
 
-func (w *Web) authorizeRequest(r *http.Request) bool {
-	bearer := r.Header.Get("Authorization")
-	if bearer == "" {
-		slog.Info("No authorization header")
-		return false
-	}
-	bearer = bearer[7:] // Remove "Bearer " prefix
-	return true         // w.secretmanager.Validate(bearer)
-}
-
+// Close releases the secret service, the AWS client and the docker client, in
+// that order.
 func (w *Web) Close() {
-	w.imageWatcher.Close()
 	w.secretmanager.Close()
+	w.imageWatcher.Close()
+	if w.journal != nil {
+		w.journal.Close()
+	}
 }
 
 func NewWeb(awsAccessKeyId, awsSecretAccessKey, region, secretName string) *Web {
-	web := &Web{}
+	web := &Web{
+		config:      newConfig(),
+		mux:         http.NewServeMux(),
+		ratelimiter: &ratelimit.RateLimiter{Limit: 2},
+	}
 
 	awsClient := aws.NewAwsClient(aws.CreateEcrClient())
 	web.imageWatcher = image_watcher.NewImageWatcher(region, awsClient)
-	ss, err := secrets.NewSecretManager(aws.CreateSecretsManagerClient(region), region, secretName)
+	web.queue = deployment.NewQueue(web.config.Deployments.Workers, web.config.Deployments.MaxQueued, func(ctx context.Context, d *deployment.Deployment) error {
+		err := web.imageWatcher.UpdateImage(ctx, d)
+		web.journalDeployment(d, err)
+		return err
+	})
+	web.poller = web.imageWatcher.NewPoller(func(event events.ImageEvent) error {
+		entry := journal.Entry{ReceivedAt: time.Now().UTC(), Source: pollerCaller, Caller: pollerCaller}
+		result, err := web.handleImageEvent(secrets.Client{Name: pollerCaller}, event)
+		journalResult(&entry, result, err)
+		web.appendJournal(entry)
+		return err
+	})
+	web.history = deployment.NewStore(web.config.Deployments.History)
+	web.dedup = dedup.New(web.config.Deployments.DeduplicationWindow)
+	ss, err := secrets.NewSecretManager(region, secretName)
 	slog.Info("Secret manager created")
 	if err != nil {
 		panic(err)
 		//("Failed to create secret manager: %v", err)
 	}
+	if web.config.Auth.Mode == AuthModeHmac && ss.HashedKeys() {
+		// signatures can only be checked with the key itself
+		panic(errors.New("hmac auth mode cannot be used with hashed keys"))
+	}
 	web.secretmanager = ss
+	web.hmacVerifier = newHmacVerifier(ss, web.config.Auth.MaxClockSkew)
+	web.mtlsAuthenticator = newMtlsAuthenticator(web.config.Auth.Mtls.Callers)
+	// the prefixes were checked when the config was loaded
+	trustedProxies, _ := parsePrefixes(web.config.Network.TrustedProxies)
+	web.clientIPs = &clientIPResolver{trustedProxies: trustedProxies}
+	web.webhookAllowlist, _ = parsePrefixes(web.config.Network.WebhookAllowlist)
+	web.adminAllowlist, _ = parsePrefixes(web.config.Network.AdminAllowlist)
+	if len(web.config.SNS.TopicArns) > 0 {
+		web.snsVerifier, err = sns.NewVerifier(web.config.SNS)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if web.config.Journal.Path != "" {
+		web.journal, err = journal.Open(web.config.Journal)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if web.config.SQS.QueueURL != "" {
+		sqsRegion := web.config.SQS.Region
+		if sqsRegion == "" {
+			sqsRegion = region
+		}
+		sqsClient := aws.CreateSqsClient(sqsRegion, web.config.SQS.Endpoint)
+		web.sqsListener = sqs_listener.NewListener(web.config.SQS, sqsClient, web.handleSQSMessage(sqsCaller(web.config.SQS.QueueURL)))
+	}
+	if env := web.config.Adapters.DockerHub.TokenEnv; env != "" {
+		web.dockerHubToken, err = adapterSecret(env)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if env := web.config.Adapters.GitHub.SecretEnv; env != "" {
+		web.gitHubSecret, err = adapterSecret(env)
+		if err != nil {
+			panic(err)
+		}
+	}
+	web.routes()
+	web.server, err = web.newServer()
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("Webhook authentication configured", "mode", web.config.Auth.Mode)
 	return web
 }
 
-func (w *Web) handleWebhook(event MyEvent) {
-	slog.Info("Received event")
-	// Handle the webhook event
-	eventString, err := json.Marshal(event)
+type webhookResult struct {
+	Status        string   `json:"status"`
+	DeploymentIDs []string `json:"deploymentIds,omitempty"`
+	Reason        string   `json:"reason,omitempty"`
+	// event is the image event the result is for, kept for the journal
+	event *events.ImageEvent
+}
+
+// imageEventKeys identifies an image event for deduplication, both by its
+// delivery id and by the image it refers to.
+func imageEventKeys(event events.ImageEvent) []string {
+	keys := []string{}
+	if event.ID != "" {
+		keys = append(keys, "event:"+event.ID)
+	}
+	if event.Digest != "" {
+		keys = append(keys, fmt.Sprintf("image:%s|%s|%s|%s", event.Action,
+			event.Repository, event.Tag, event.Digest))
+	}
+	return keys
+}
+
+// handleWebhook acts on successful ECR pushes and deletes through
+// handleImageEvent and acknowledges every other event without acting on it.
+func (w *Web) handleWebhook(caller secrets.Client, event events.EcrEvent) (webhookResult, error) {
+	log := slog.With("caller", caller.Name, "event-id", event.ID, "repository", event.Detail.RepositoryName, "image-tag", event.Detail.ImageTag)
+	log.Info("Received event", "detail-type", event.DetailType, "action-type", event.Detail.ActionType, "result", event.Detail.Result)
+	if reason := event.IgnoreReason(); reason != "" {
+		log.Info("Ignoring event", "reason", reason)
+		return webhookResult{Status: "ignored", Reason: reason}, nil
+	}
+	return w.handleImageEvent(caller, event.ImageEvent())
+}
+
+// handleImageEvent queues deployments for pushes to watched images and
+// hands deletes to the image watcher. Events that repeat one seen within the
+// deduplication window are recorded as duplicates and not acted on. Events
+// for images caller may not deploy fail with ErrNotAllowed, and rollbacks to
+// tags it may not deploy are left out.
+func (w *Web) handleImageEvent(caller secrets.Client, event events.ImageEvent) (webhookResult, error) {
+	log := slog.With("caller", caller.Name, "event-id", event.ID, "registry", event.Registry, "repository", event.Repository, "image-tag", event.Tag)
+	image := "/" + event.Repository
+	isDelete := event.Action == events.ActionDelete
+	if !isDelete && !w.imageWatcher.IsWatched(event.Registry, image, event.Tag) {
+		log.Info("Ignoring event", "reason", "image is not watched")
+		return webhookResult{Status: "ignored", Reason: "image is not watched", event: &event}, nil
+	}
+	if !caller.Allows(event.Repository, event.Tag) {
+		log.Info("Rejected image not allowed for caller")
+		return webhookResult{}, notAllowed(caller, event.Repository, event.Tag)
+	}
+	trigger := deployment.TriggerWebhook
+	if isDelete {
+		trigger = deployment.TriggerRollback
+	}
+
+	keys := imageEventKeys(event)
+	if origin, duplicate := w.dedup.Seen(event.ID, keys...); duplicate {
+		d := deployment.New(trigger, image, event.Tag)
+		d.Caller = caller.Name
+		d.EventID = event.ID
+		d.MarkDuplicate(origin)
+		w.history.Add(d)
+		log.Info("Ignoring duplicate event", "duplicate-of", origin)
+		return webhookResult{
+			Status:        string(deployment.StatusDuplicate),
+			DeploymentIDs: []string{d.ID},
+			Reason:        "duplicate of event " + origin,
+			event:         &event,
+		}, nil
+	}
+
+	// pushes go to the entry whose prefix matches the tag
+	targets := []image_watcher.Target{{Tag: event.Tag}}
+	if isDelete {
+		targets = slices.DeleteFunc(w.imageWatcher.DeleteImage(event.Registry, image, event.Tag, event.Digest), func(target image_watcher.Target) bool {
+			if caller.Allows(event.Repository, target.Tag) {
+				return false
+			}
+			log.Warn("Not rolling back to image tag not allowed for caller", "rollback-tag", target.Tag)
+			return true
+		})
+		if len(targets) == 0 {
+			return webhookResult{Status: "accepted", event: &event}, nil
+		}
+	}
+	result := webhookResult{Status: string(deployment.StatusQueued), event: &event}
+	for _, target := range targets {
+		d := deployment.New(trigger, image, target.Tag)
+		d.ImageTagPrefix = target.Prefix
+		d.Caller = caller.Name
+		d.EventID = event.ID
+		if err := w.enqueue(d); err != nil {
+			// let the sender's retry through, unless it would queue the
+			// deployments before this one again
+			if len(result.DeploymentIDs) == 0 {
+				w.dedup.Forget(keys...)
+			}
+			return result, err
+		}
+		result.DeploymentIDs = append(result.DeploymentIDs, d.ID)
+	}
+	return result, nil
+}
+
+func (w *Web) enqueue(d *deployment.Deployment) error {
+	enqueue := w.queue.Enqueue
+	if w.replaying {
+		enqueue = w.queue.EnqueueWait
+	}
+	err := enqueue(d)
 	if err != nil {
-		slog.Error("Failed to marshal event: %v", err)
-		return
+		slog.Error("Failed to queue deployment", "repository", d.Repository, "image-tag", d.Tag, "error", err)
+		return err
 	}
-	event.Detail.RepositoryName = "/" + event.Detail.RepositoryName
-	slog.Info("Received event ", string(eventString), "\n")
-	w.imageWatcher.UpdateImage(event.Detail.RepositoryName, event.Detail.ImageTag)
-	//watchedImage, ok := watchedImages.Load(event.Detail.RepositoryName)
-	//if !ok {
-	//	return
-	//}
-	//image, ok := watchedImage.(WatchedImage)
-	//if !ok {
-	//	return
-	//}
-	//image.PreviousImageTag = image.ImageTag
-	//image.ImageTag = event.Detail.ImageTag
-	//image.StartTime = time.Now()
-	//watchedImages.Store(event.Detail.RepositoryName, image)
-}
-
-func (w *Web) Start() {
-	w.imageWatcher.Start()
-	w.secretmanager.Start()
-	ratelimiter := ratelimit.RateLimiter{Limit: 2}
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+	w.history.Add(d)
+	return nil
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	err := json.NewEncoder(rw).Encode(v)
+	if err != nil {
+		slog.Error("Failed to write response", "error", err)
+	}
+}
+
+// handleHealth answers OK while the webhook key is fresh. A failing secret
+// refresh is reported in the body, and fails the check once the key is
+// stale.
+func (w *Web) handleHealth(rw http.ResponseWriter, r *http.Request) {
+	var err error
+	if w.secretmanager != nil {
+		err = w.secretmanager.Health()
+	}
+	switch {
+	case err == nil:
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte("OK"))
+	case errors.Is(err, secrets.ErrStale):
+		// the endpoint is unauthenticated, so the details only go to the log
+		slog.Error("Health check failed", "error", err)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write([]byte("UNHEALTHY"))
+	default:
+		slog.Warn("Health check degraded", "error", err)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte("DEGRADED"))
+	}
+}
+
+func (w *Web) routes() {
+	w.mux.HandleFunc("/health", w.handleHealth)
+	w.mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		writeProblem(rw, r, http.StatusNotFound, CodeNotFound, "no such endpoint")
 	})
 
-	http.HandleFunc("/update", func(rw http.ResponseWriter, r *http.Request) {
-		slog.Info("Received request")
-		// Parse the request body
-		if ratelimiter.RateLimitsExceeded(r.RemoteAddr) {
-			http.Error(rw, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
-		}
+	w.route(http.MethodPost, "/update", w.allowFrom(w.webhookAllowlist, w.journaled(RouteUpdate, w.handleUpdate)))
+	w.route(http.MethodPost, "/registry", w.allowFrom(w.webhookAllowlist, w.journaled(RouteRegistry, w.handleRegistry)))
+	if w.dockerHubToken != nil {
+		w.route(http.MethodPost, "/dockerhub", w.allowFrom(w.webhookAllowlist, w.journaled(RouteDockerHub, w.handleDockerHub)))
+	}
+	if w.gitHubSecret != nil {
+		w.route(http.MethodPost, "/github", w.allowFrom(w.webhookAllowlist, w.journaled(RouteGitHub, w.handleGitHub)))
+	}
+	if w.snsVerifier != nil {
+		w.route(http.MethodPost, "/sns", w.allowFrom(w.webhookAllowlist, w.journaled(RouteSNS, w.handleSNS)))
+	}
+	w.route(http.MethodGet, "/deployments", w.allowFrom(w.adminAllowlist, w.listDeployments))
+	w.route(http.MethodGet, "/deployments/{id}", w.allowFrom(w.adminAllowlist, w.getDeployment))
+	w.route(http.MethodGet, "/images", w.allowFrom(w.adminAllowlist, w.listImages))
+	w.route(http.MethodPost, "/images/{repo}/{prefix}/rollback", w.allowFrom(w.adminAllowlist, w.rollbackImage))
+	w.route(http.MethodPost, "/images/{repo}/{prefix}/deploy", w.allowFrom(w.adminAllowlist, w.deployImage))
+	// images watched with an empty tag prefix
+	w.route(http.MethodPost, "/images/{repo}/rollback", w.allowFrom(w.adminAllowlist, w.rollbackImage))
+	w.route(http.MethodPost, "/images/{repo}/deploy", w.allowFrom(w.adminAllowlist, w.deployImage))
+}
+
+// handleUpdate receives ECR events delivered by EventBridge.
+func (w *Web) handleUpdate(rw http.ResponseWriter, r *http.Request) {
+	slog.Info("Received request")
+	if w.ratelimiter.RateLimitsExceeded(clientAddr(r)) {
+		writeProblem(rw, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+		return
+	}
+	if !requireJSON(rw, r) {
+		return
+	}
+	body, ok := readBody(rw, r, w.config.MaxBodyBytes[RouteUpdate])
+	if !ok {
+		return
+	}
+	caller, err := w.authorizeRequest(r, body)
+	journalAuth(r, caller.Name, err)
+	if err != nil {
+		w.writeUnauthorized(rw, r, err)
+		return
+	}
+	var event events.EcrEvent
+	if !decodeStrict(rw, r, body, &event) {
+		return
+	}
+	result, err := w.handleWebhook(caller, event)
+	writeWebhookResult(rw, r, result, err)
+}
+
+// writeWebhookResult answers 202 when deployments were queued and 200 when
+// the event was acknowledged without one.
+func writeWebhookResult(rw http.ResponseWriter, r *http.Request, result webhookResult, err error) {
+	if errors.Is(err, ErrNotAllowed) {
+		writeProblem(rw, r, http.StatusForbidden, CodeForbidden, err.Error())
+		return
+	}
+	if entry := journalEntry(r); entry != nil {
+		journalResult(entry, result, err)
+	}
+	if err != nil {
+		writeProblem(rw, r, http.StatusServiceUnavailable, CodeQueueUnavailable, err.Error())
+		return
+	}
+	if result.Status == string(deployment.StatusQueued) {
+		writeJSON(rw, http.StatusAccepted, result)
+		return
+	}
+	writeJSON(rw, http.StatusOK, result)
+}
 
-		if !w.authorizeRequest(r) {
-			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+type clientAddrKey struct{}
+
+// allowFrom resolves the client address of a request and rejects it unless
+// allowlist contains it. The address is made available through clientAddr.
+func (w *Web) allowFrom(allowlist []netip.Prefix, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		addr, err := w.clientIPs.clientIP(r)
+		if err != nil || !allowedBy(allowlist, addr) {
+			slog.Info("Rejected request from disallowed address", "client-ip", addr.String(), "path", r.URL.Path)
+			writeProblem(rw, r, http.StatusForbidden, CodeForbidden, "client address is not allowed")
 			return
 		}
-		var event MyEvent
-		err := json.NewDecoder(r.Body).Decode(&event)
+		next(rw, r.WithContext(context.WithValue(r.Context(), clientAddrKey{}, addr.String())))
+	}
+}
+
+// clientAddr returns the client address resolved by allowFrom.
+func clientAddr(r *http.Request) string {
+	addr, _ := r.Context().Value(clientAddrKey{}).(string)
+	return addr
+}
+
+func (w *Web) newServer() (*http.Server, error) {
+	listen := w.config.Listen
+	server := &http.Server{
+		Addr:              listen.Address,
+		Handler:           w.mux,
+		ReadHeaderTimeout: listen.ReadHeaderTimeout,
+		ReadTimeout:       listen.ReadTimeout,
+		WriteTimeout:      listen.WriteTimeout,
+		IdleTimeout:       listen.IdleTimeout,
+	}
+	if listen.TLS.CertFile == "" {
+		return server, nil
+	}
+	certs, err := newCertReloader(listen.TLS.CertFile, listen.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	minVersion, err := parseTLSVersion(listen.TLS.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	server.TLSConfig = &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: certs.GetCertificate,
+	}
+	if w.config.Auth.Mode == AuthModeMtls {
+		clientCAs, err := loadCertPool(w.config.Auth.Mtls.ClientCAFile)
 		if err != nil {
-			http.Error(rw, "Failed to parse request body", http.StatusBadRequest)
-			return
+			return nil, err
 		}
+		// certificates are only required by the authenticated routes, so
+		// health checks keep working without one
+		server.TLSConfig.ClientCAs = clientCAs
+		server.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return server, nil
+}
 
-		w.handleWebhook(event)
+// Start starts the background services and serves requests until Shutdown
+// is called. It returns nil after a Shutdown and the listener error otherwise.
+func (w *Web) Start() error {
+	w.imageWatcher.Start()
+	w.secretmanager.Start()
+	w.queue.Start()
+	if w.sqsListener != nil {
+		w.sqsListener.Start()
+	}
+	if w.poller != nil {
+		w.poller.Start()
+	}
+	slog.Info("(web) Starting web server", "address", w.server.Addr, "tls", w.server.TLSConfig != nil)
+	var err error
+	if w.server.TLSConfig != nil {
+		err = w.server.ListenAndServeTLS("", "")
+	} else {
+		err = w.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
 
-		rw.WriteHeader(http.StatusOK)
-	})
-	slog.Info("(web) Starting web server")
-	http.ListenAndServe(":8080", nil)
+// Shutdown stops accepting requests, lets in-flight requests and deployments
+// finish or roll back within the configured shutdown timeout and then closes
+// the remaining services.
+func (w *Web) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.ShutdownTimeout)
+	defer cancel()
+	slog.Info("(web) Shutting down", "timeout", w.config.ShutdownTimeout)
+	var listenerErr, pollerErr error
+	if w.sqsListener != nil {
+		listenerErr = w.sqsListener.Stop(ctx)
+		if listenerErr != nil {
+			slog.Error("Failed to stop SQS listener", "error", listenerErr)
+		}
+	}
+	if w.poller != nil {
+		pollerErr = w.poller.Stop(ctx)
+		if pollerErr != nil {
+			slog.Error("Failed to stop ECR poller", "error", pollerErr)
+		}
+	}
+	serverErr := w.server.Shutdown(ctx)
+	if serverErr != nil {
+		slog.Error("Failed to stop web server gracefully", "error", serverErr)
+	}
+	queueErr := w.queue.Shutdown(ctx)
+	if queueErr != nil {
+		slog.Error("Deployments did not finish before the shutdown deadline", "error", queueErr)
+	}
+	w.Close()
+	slog.Info("(web) Shutdown complete")
+	return errors.Join(listenerErr, pollerErr, serverErr, queueErr)
 }
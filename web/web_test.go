@@ -0,0 +1,181 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ljos.app/ecr-change-receiver/dedup"
+	"ljos.app/ecr-change-receiver/deployment"
+	"ljos.app/ecr-change-receiver/events"
+	"ljos.app/ecr-change-receiver/image_watcher"
+	"ljos.app/ecr-change-receiver/ratelimit"
+)
+
+// newTestWeb returns a Web watching images, keyed by repository name and tag
+// prefix, whose callers authenticate with client certificates. configure may
+// change it before the routes are registered. Deployments are queued but not
+// run.
+func newTestWeb(images map[string]map[string]image_watcher.Image, callers []MtlsCaller, configure func(w *Web)) *Web {
+	config := &Config{Auth: AuthConfig{Mode: AuthModeMtls}}
+	config.setDefaults()
+	w := &Web{
+		config:       config,
+		mux:          http.NewServeMux(),
+		imageWatcher: image_watcher.NewStaticImageWatcher(images),
+		queue: deployment.NewQueue(1, 10, func(ctx context.Context, d *deployment.Deployment) error {
+			return nil
+		}),
+		history:           deployment.NewStore(10),
+		dedup:             dedup.New(time.Minute),
+		ratelimiter:       &ratelimit.RateLimiter{Limit: 100},
+		mtlsAuthenticator: newMtlsAuthenticator(callers),
+		clientIPs:         &clientIPResolver{},
+	}
+	if configure != nil {
+		configure(w)
+	}
+	w.routes()
+	return w
+}
+
+// serve sends a JSON request to w, authenticated as the client certificate
+// identity when it is not empty.
+func serve(w *Web, method, target, identity, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	r.Header.Set("Content-Type", "application/json")
+	if identity != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: identity}}
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+	rec := httptest.NewRecorder()
+	w.mux.ServeHTTP(rec, r)
+	return rec
+}
+
+func decodeResult(t *testing.T, rec *httptest.ResponseRecorder) webhookResult {
+	t.Helper()
+	var result webhookResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result %q: %v", rec.Body.String(), err)
+	}
+	return result
+}
+
+// ecrEvent is an EventBridge ECR event for tag of repository.
+func ecrEvent(id, action, result, repository, tag string) string {
+	return `{"version":"0","id":"` + id + `","detail-type":"ECR Image Action","source":"aws.ecr",` +
+		`"account":"123456789012","time":"2024-07-01T12:00:00Z","region":"eu-north-1","resources":[],` +
+		`"detail":{"result":"` + result + `","repository-name":"` + repository + `","image-digest":"sha256:abc",` +
+		`"action-type":"` + action + `","image-tag":"` + tag + `"}}`
+}
+
+func TestHandleImageEventDeduplicates(t *testing.T) {
+	w := newTestWeb(map[string]map[string]image_watcher.Image{
+		"/image1": {"v": {RepositoryName: "/image1", ImageTag: "v1", Registry: events.RegistryEcr}},
+	}, []MtlsCaller{{Name: "relay", Identities: []string{"relay"}}}, nil)
+
+	body := ecrEvent("event-1", "PUSH", "SUCCESS", "image1", "v2")
+	first := serve(w, http.MethodPost, "/update", "relay", body)
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("Expected the event to be queued, got %d %s", first.Code, first.Body)
+	}
+	second := serve(w, http.MethodPost, "/update", "relay", body)
+	if second.Code != http.StatusOK {
+		t.Fatalf("Expected the repeated event to be acknowledged, got %d %s", second.Code, second.Body)
+	}
+	if result := decodeResult(t, second); result.Status != string(deployment.StatusDuplicate) {
+		t.Errorf("Expected a duplicate result, got %+v", result)
+	}
+
+	var queued, duplicates int
+	for _, record := range w.history.List() {
+		switch record.Status {
+		case deployment.StatusQueued:
+			queued++
+		case deployment.StatusDuplicate:
+			duplicates++
+		}
+	}
+	if queued != 1 || duplicates != 1 {
+		t.Errorf("Expected one deployment and one duplicate record, got %d and %d", queued, duplicates)
+	}
+}
+
+func TestHandleImageEventKeepsPartlyQueuedEventsDeduplicated(t *testing.T) {
+	w := newTestWeb(map[string]map[string]image_watcher.Image{
+		"/image1": {
+			"v":  {RepositoryName: "/image1", ImageTag: "v1.1", PreviousImageTag: "v1.0", OnDelete: image_watcher.OnDeleteRollback, Registry: events.RegistryEcr},
+			"v1": {RepositoryName: "/image1", ImageTag: "v1.1", PreviousImageTag: "v0.9", OnDelete: image_watcher.OnDeleteRollback, Registry: events.RegistryEcr},
+		},
+	}, []MtlsCaller{{Name: "relay", Identities: []string{"relay"}}}, func(w *Web) {
+		w.queue = deployment.NewQueue(1, 1, func(ctx context.Context, d *deployment.Deployment) error { return nil })
+	})
+
+	body := ecrEvent("event-1", "DELETE", "SUCCESS", "image1", "v1.1")
+	if rec := serve(w, http.MethodPost, "/update", "relay", body); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the second rollback not to fit the queue, got %d %s", rec.Code, rec.Body)
+	}
+	retry := serve(w, http.MethodPost, "/update", "relay", body)
+	if result := decodeResult(t, retry); result.Status != string(deployment.StatusDuplicate) {
+		t.Errorf("Expected the retry not to queue the first rollback again, got %d %+v", retry.Code, result)
+	}
+}
+
+func TestRestrictedClient(t *testing.T) {
+	w := newTestWeb(map[string]map[string]image_watcher.Image{
+		"/image1": {
+			"staging": {RepositoryName: "/image1", ImageTag: "staging-1", PreviousImageTag: "prod-1", OnDelete: image_watcher.OnDeleteRollback, Registry: events.RegistryEcr},
+			"prod":    {RepositoryName: "/image1", ImageTag: "prod-1", Registry: events.RegistryEcr},
+		},
+		"/tools": {"v": {RepositoryName: "/tools", ImageTag: "v1", Registry: events.RegistryDistribution}},
+	}, []MtlsCaller{{Name: "ci", Identities: []string{"ci"}, Repositories: []string{"image1", "tools"}, TagPrefixes: []string{"staging", "v2"}}}, nil)
+
+	testCases := []struct {
+		name   string
+		target string
+		body   string
+		code   int
+		status string
+	}{
+		{"allowed push", "/update", ecrEvent("event-1", "PUSH", "SUCCESS", "image1", "staging-2"), http.StatusAccepted, "queued"},
+		{"push not allowed", "/update", ecrEvent("event-2", "PUSH", "SUCCESS", "image1", "prod-2"), http.StatusForbidden, ""},
+		{"failed push", "/update", ecrEvent("event-3", "PUSH", "FAILURE", "image1", "prod-2"), http.StatusOK, "ignored"},
+		{"rollback not allowed", "/update", ecrEvent("event-6", "DELETE", "SUCCESS", "image1", "staging-1"), http.StatusOK, "accepted"},
+		{"deploy not allowed", "/images/image1/prod/deploy?tag=prod-2", "", http.StatusForbidden, ""},
+		{"allowed deploy", "/images/image1/staging/deploy?tag=staging-3", "", http.StatusAccepted, "queued"},
+		{"registry push not allowed", "/registry", `{"events":[{"id":"event-4","action":"push","target":{"repository":"tools","tag":"v1.1","digest":"sha256:abc"}}]}`, http.StatusOK, "ignored"},
+		{"allowed registry push", "/registry", `{"events":[{"id":"event-5","action":"push","target":{"repository":"tools","tag":"v2.0","digest":"sha256:def"}}]}`, http.StatusAccepted, "queued"},
+	}
+	for _, tc := range testCases {
+		rec := serve(w, http.MethodPost, tc.target, "ci", tc.body)
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.code, rec.Code, rec.Body)
+			continue
+		}
+		if tc.code == http.StatusForbidden {
+			if p := decodeProblem(t, rec); p.Code != CodeForbidden {
+				t.Errorf("%s: expected code %s, got %s", tc.name, CodeForbidden, p.Code)
+			}
+			continue
+		}
+		if result := decodeResult(t, rec); result.Status != tc.status {
+			t.Errorf("%s: expected status %s, got %+v", tc.name, tc.status, result)
+		}
+	}
+}